@@ -2,8 +2,11 @@ package cmd
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
@@ -15,6 +18,8 @@ import (
 
 var cfg = configs.Config{} // nolint:gochecknoglobals // the early default is zero value
 
+var cfgFile string // nolint:gochecknoglobals // flag
+
 var rootCmd = &cobra.Command{ // nolint:gochecknoglobals // zero values are good defaults
 	Use:   "kubeproxy-ext",
 	Short: "Extension to kubeproxy",
@@ -26,10 +31,12 @@ var rootCmd = &cobra.Command{ // nolint:gochecknoglobals // zero values are good
 			"BuildTime", buildinfo.BuildTime,
 			// "GoMod", buildinfo.GoMod,
 		)
+		cfg.Proxy.Modifiers = configs.RegisteredModifiers()
 		if server, err := proxy.New(cfg.Proxy, log.Logger); err != nil {
 			log.Error(err, "new proxy")
 			os.Exit(1)
 		} else {
+			watchConfig(server)
 			server.Serve()
 		}
 	},
@@ -44,6 +51,8 @@ func Execute() {
 
 func init() {
 	cobra.OnInitialize(initConfig)
+
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (YAML, TOML, JSON, etc.), reloaded on change")
 }
 
 var log *logger.Logger // nolint:gochecknoglobals // OK
@@ -54,10 +63,138 @@ func initConfig() {
 	configs.SetDefaults()
 	viper.AutomaticEnv()
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	if cfgFile != "" {
+		viper.SetConfigFile(cfgFile)
+		if err := viper.ReadInConfig(); err != nil {
+			log.Error(err, "Config ReadInConfig")
+			os.Exit(1)
+		}
+	}
 	if err := viper.Unmarshal(&cfg); err != nil {
 		log.Error(err, "Config Unmarshal")
 	}
 	log.SetLevel(cfg.LogLevel)
+	if err := configs.LoadProxyKinds(&cfg.Proxy); err != nil {
+		log.Error(err, "Config Kinds")
+		os.Exit(1)
+	}
 
 	log.Info("Config", logger.MapToKV(viper.AllSettings())...)
 }
+
+// reloadMu serializes the reloads and all accesses to the viper instances after the start:
+// the global one (config file) and the one of the ColumnsFile, see configs.LoadKinds
+var reloadMu sync.Mutex // nolint:gochecknoglobals // serializes the reloads
+
+// columnsWatcher watches the current ColumnsFile, guarded by reloadMu
+var columnsWatcher *fsnotify.Watcher // nolint:gochecknoglobals // re-armed on ColumnsFile change
+
+// watchConfig reloads the config file and the columns file on change
+func watchConfig(server *proxy.Service) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	if cfgFile != "" {
+		if _, err := watchFile(cfgFile, server); err != nil {
+			log.Error(err, "Config watch", "file", cfgFile)
+		}
+	}
+	watchColumnsFile(server)
+}
+
+// watchColumnsFile (re-)arms the watcher of the ColumnsFile. The caller must hold reloadMu.
+func watchColumnsFile(server *proxy.Service) {
+	if columnsWatcher != nil {
+		columnsWatcher.Close() // nolint:errcheck,gosec // always nil
+		columnsWatcher = nil
+	}
+	if cfg.Proxy.ColumnsFile == "" {
+		return
+	}
+
+	watcher, err := watchFile(cfg.Proxy.ColumnsFile, server)
+	if err != nil {
+		log.Error(err, "Config watch", "file", cfg.Proxy.ColumnsFile)
+
+		return
+	}
+	columnsWatcher = watcher
+}
+
+// watchFile reloads the config, when the file is written or replaced. The directory of the file is watched,
+// so atomic saves and the symlink swaps of the Kubernetes ConfigMap volumes are detected, too.
+// Unlike viper.WatchConfig, the file isn't read by the watcher, see reloadConfig.
+func watchFile(file string, server *proxy.Service) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	file = filepath.Clean(file)
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close() // nolint:errcheck,gosec // always nil
+
+		return nil, err
+	}
+
+	realFile, _ := filepath.EvalSymlinks(file) // nolint:errcheck // the file may be missing
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				currentFile, _ := filepath.EvalSymlinks(file) // nolint:errcheck // the file may be missing
+				written := filepath.Clean(event.Name) == file && event.Op&(fsnotify.Write|fsnotify.Create) != 0
+				if written || (currentFile != "" && currentFile != realFile) {
+					realFile = currentFile
+					reloadConfig(server, file)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Error(err, "Config watch", "file", file)
+			}
+		}
+	}()
+
+	return watcher, nil
+}
+
+// reloadConfig applies the runtime-safe settings (LogLevel, Pod columns and joins, column sets).
+// The previous config is kept, if the new one is invalid.
+func reloadConfig(server *proxy.Service, file string) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	var err error
+	if cfgFile != "" {
+		err = viper.ReadInConfig()
+	}
+	newCfg := configs.Config{}
+	if err == nil {
+		err = viper.Unmarshal(&newCfg)
+	}
+	if err == nil {
+		err = configs.LoadProxyKinds(&newCfg.Proxy)
+	}
+	if err == nil {
+		err = server.Reload(newCfg.Proxy)
+	}
+	proxy.ObserveConfigReload(err)
+	if err != nil {
+		log.Error(err, "Config reload", "file", file)
+
+		return
+	}
+
+	log.SetLevel(newCfg.LogLevel)
+	cfg.LogLevel = newCfg.LogLevel
+	columnsFile := cfg.Proxy.ColumnsFile
+	cfg.Proxy = newCfg.Proxy
+	if cfg.Proxy.ColumnsFile != columnsFile {
+		watchColumnsFile(server)
+	}
+	log.Info("Config reloaded", "file", file)
+}
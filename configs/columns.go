@@ -0,0 +1,102 @@
+package configs
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// Column naming conventions of the printer columns
+const (
+	ColumnNamingCamelCase = "CamelCase"  // NominatedNode (default)
+	ColumnNamingSnakeCase = "snake_case" // nominated_node
+	ColumnNamingUpperCase = "UPPER_CASE" // NOMINATED_NODE
+)
+
+// Printer outputs, same to `kubectl get -o wide`
+const (
+	ColumnOutputWide   = "wide" // default
+	ColumnOutputNormal = "normal"
+)
+
+// KindColumns is the column set of a kind, loaded from the ColumnsFile (or from the config file), for example:
+//
+//	kinds:
+//	- kind: Pod
+//	  key: kubectl
+//	  output: wide
+//	  naming: CamelCase
+//	  columns:
+//	  - name: Name
+//	  - name: Status
+//	    rename: State
+//	  jsonPathColumns:
+//	  - name: Images
+//	    jsonPath: .spec.containers[*].image
+//	- kind: Deployment
+//	  group: apps
+type KindColumns struct {
+	// Kind of the objects, for example: Pod
+	Kind string
+	// Group of the Kind, for example: apps, default: core group
+	Group string
+	// Key is the target key in the object, default: ObjectKeyKubectl
+	Key string
+	// Output of the printer: wide or normal, default: wide
+	Output string
+	// Naming of the printer columns: CamelCase, snake_case or UPPER_CASE, default: CamelCase
+	Naming string
+	// Columns are the kept printer columns, default: all
+	Columns []PrinterColumn
+	// JSONPathColumns are additional columns, same to `kubectl get -o custom-columns=`
+	JSONPathColumns []JSONPathColumn
+}
+
+// PrinterColumn selects a printer column (same to the header of `kubectl get`, for example: Nominated Node)
+type PrinterColumn struct {
+	Name string
+	// Rename is the new name of the column, instead of the Naming convention
+	Rename string
+}
+
+// JSONPathColumn is an additional column, for example: .spec.containers[*].image
+type JSONPathColumn struct {
+	Name     string
+	JSONPath string
+}
+
+// LoadKinds loads the column sets from a config file (YAML, TOML, JSON, etc.)
+func LoadKinds(file string) ([]KindColumns, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("%w: read %s: %s", ErrInvalidKindColumns, file, err)
+	}
+
+	kinds := []KindColumns{}
+	if err := v.UnmarshalKey("kinds", &kinds); err != nil {
+		return nil, fmt.Errorf("%w: unmarshal %s: %s", ErrInvalidKindColumns, file, err)
+	}
+
+	return kinds, nil
+}
+
+// LoadProxyKinds loads the column sets from the ColumnsFile, or from the kinds key of the config file
+func LoadProxyKinds(cfg *Proxy) error {
+	if cfg.ColumnsFile != "" {
+		kinds, err := LoadKinds(cfg.ColumnsFile)
+		if err != nil {
+			return err
+		}
+		cfg.Kinds = kinds
+
+		return nil
+	}
+
+	cfg.Kinds = []KindColumns{}
+	if err := viper.UnmarshalKey("kinds", &cfg.Kinds); err != nil {
+		return fmt.Errorf("%w: unmarshal kinds: %s", ErrInvalidKindColumns, err)
+	}
+
+	return nil
+}
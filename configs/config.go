@@ -32,4 +32,159 @@ func SetDefaults() {
 	if err := viper.BindEnv("Proxy.ListenAddr"); err != nil {
 		panic(err)
 	}
+
+	viper.SetDefault("Proxy.PodResources", true)
+	if err := viper.BindEnv("Proxy.PodResources"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.PodMetrics", false)
+	if err := viper.BindEnv("Proxy.PodMetrics"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.PodEvents", false)
+	if err := viper.BindEnv("Proxy.PodEvents"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.ColumnsFile", "")
+	if err := viper.BindEnv("Proxy.ColumnsFile"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.ClusterName", "")
+	if err := viper.BindEnv("Proxy.ClusterName"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.AggregateTimeout", "10s")
+	if err := viper.BindEnv("Proxy.AggregateTimeout"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.Namespaces", []string{})
+	if err := viper.BindEnv("Proxy.Namespaces"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.StreamLists", true)
+	if err := viper.BindEnv("Proxy.StreamLists"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.EnrichWorkers", 0)
+	if err := viper.BindEnv("Proxy.EnrichWorkers"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.MaxBodySize", 64*1024*1024) // nolint:gomnd // 64Mi
+	if err := viper.BindEnv("Proxy.MaxBodySize"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.PageSize", 500) // nolint:gomnd // same to kubectl
+	if err := viper.BindEnv("Proxy.PageSize"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.PaginateMaxItems", 10000) // nolint:gomnd // 20 pages
+	if err := viper.BindEnv("Proxy.PaginateMaxItems"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.ETag", true)
+	if err := viper.BindEnv("Proxy.ETag"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.ETagAgeBucket", "1m")
+	if err := viper.BindEnv("Proxy.ETagAgeBucket"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.CacheTTL", "0s")
+	if err := viper.BindEnv("Proxy.CacheTTL"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.CacheMaxBytes", 64*1024*1024) // nolint:gomnd // 64Mi
+	if err := viper.BindEnv("Proxy.CacheMaxBytes"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.CacheMaxEntries", 1000) // nolint:gomnd // dashboards
+	if err := viper.BindEnv("Proxy.CacheMaxEntries"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.DialTimeout", "5s")
+	if err := viper.BindEnv("Proxy.DialTimeout"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.TLSHandshakeTimeout", "5s")
+	if err := viper.BindEnv("Proxy.TLSHandshakeTimeout"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.ResponseHeaderTimeout", "30s")
+	if err := viper.BindEnv("Proxy.ResponseHeaderTimeout"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.RequestTimeout", "60s")
+	if err := viper.BindEnv("Proxy.RequestTimeout"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.RetryMax", 2)
+	if err := viper.BindEnv("Proxy.RetryMax"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.RetryBackoff", "200ms")
+	if err := viper.BindEnv("Proxy.RetryBackoff"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.BreakerFailures", 5)
+	if err := viper.BindEnv("Proxy.BreakerFailures"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.BreakerCooldown", "30s")
+	if err := viper.BindEnv("Proxy.BreakerCooldown"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.EnrichmentWarnings", true)
+	if err := viper.BindEnv("Proxy.EnrichmentWarnings"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.EnrichmentStrict", false)
+	if err := viper.BindEnv("Proxy.EnrichmentStrict"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.UpstreamProtobuf", false)
+	if err := viper.BindEnv("Proxy.UpstreamProtobuf"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.Compression", []string{"gzip", "deflate"})
+	if err := viper.BindEnv("Proxy.Compression"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.CompressionMinSize", 1024) // nolint:gomnd // 1Ki
+	if err := viper.BindEnv("Proxy.CompressionMinSize"); err != nil {
+		panic(err)
+	}
+
+	viper.SetDefault("Proxy.CompressionLevel", 0)
+	if err := viper.BindEnv("Proxy.CompressionLevel"); err != nil {
+		panic(err)
+	}
 }
@@ -0,0 +1,61 @@
+package configs
+
+import (
+	"net/http"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ModifierScope is the set of the responses, where a Modifier is applied
+type ModifierScope int
+
+const (
+	// ScopeList is the items of the lists (also the streamed, paginated and fan-out lists)
+	ScopeList ModifierScope = 1 << iota
+	// ScopeObject is the single objects
+	ScopeObject
+	// ScopeWatch is the objects of the watch events
+	ScopeWatch
+
+	ScopeAll = ScopeList | ScopeObject | ScopeWatch
+)
+
+// Modifier enriches the items of the responses, for example: adds kubectl columns, redacts fields
+// or resolves owners. The built-in kubectl columns are Modifiers, too.
+// A Modifier is called concurrently, on the items of a list.
+type Modifier interface {
+	// Name identifies the modifier in the errors
+	Name() string
+	// Matches returns true, if the modifier applies to the kind of the item
+	Matches(gvk schema.GroupVersionKind) bool
+	// Scope returns the responses, where the modifier is applied
+	Scope() ModifierScope
+	// Order sorts the modifiers of an item, the lower runs first. The built-in kubectl columns are 0.
+	Order() int
+	// Modify modifies the item. The request is the client request (without the own query parameters),
+	// its context is canceled, if the client disconnects.
+	Modify(req *http.Request, item *unstructured.Unstructured) error
+}
+
+var (
+	modifiersMu sync.Mutex // nolint:gochecknoglobals // guards modifiers
+	modifiers   []Modifier // nolint:gochecknoglobals // registry
+)
+
+// RegisterModifier registers modifiers for the proxy started by the command, see RegisteredModifiers.
+// It must be called before the command is executed, typically from an init function.
+func RegisterModifier(modifier ...Modifier) {
+	modifiersMu.Lock()
+	defer modifiersMu.Unlock()
+	modifiers = append(modifiers, modifier...)
+}
+
+// RegisteredModifiers returns the registered modifiers
+func RegisteredModifiers() []Modifier {
+	modifiersMu.Lock()
+	defer modifiersMu.Unlock()
+
+	return append([]Modifier{}, modifiers...)
+}
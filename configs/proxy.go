@@ -3,6 +3,7 @@ package configs
 import (
 	"errors"
 	"net/http"
+	"time"
 )
 
 const (
@@ -12,12 +13,131 @@ const (
 var (
 	ErrGenerateTableNoRow    = errors.New("generatetable no row")
 	ErrGenerateTableMoreRows = errors.New("generatetable more rows")
+	ErrUpstreamStatus        = errors.New("upstream status")
+
+	ErrInvalidKubectlSelector = errors.New("invalid kubectlSelector")
+	ErrInvalidKubectlSortBy   = errors.New("invalid kubectlSortBy")
+	ErrInvalidKubectlLimit    = errors.New("invalid kubectlLimit")
+	ErrInvalidKubectlColumns  = errors.New("invalid kubectlColumns")
+	ErrInvalidKubectlOutput   = errors.New("invalid kubectlOutput")
+	ErrUnsupportedKubectlKind = errors.New("kubectlSelector and kubectlSortBy not supported for kind")
+
+	ErrInvalidKindColumns = errors.New("invalid kind columns")
+
+	ErrUnknownCluster    = errors.New("unknown cluster")
+	ErrInvalidCluster    = errors.New("invalid cluster")
+	ErrAggregateFailed   = errors.New("aggregate failed")
+	ErrInvalidNamespaces = errors.New("invalid namespaces")
+	ErrBodyTooLarge      = errors.New("body too large")
+	ErrResourceExpired   = errors.New("resource expired")
+	ErrResourceNotFound  = errors.New("resource not found")
+	ErrInvalidPaginate   = errors.New("invalid paginate")
+	ErrUpstreamFailed    = errors.New("upstream failed")
+
+	ErrInvalidCompression  = errors.New("invalid compression")
+	ErrUnsupportedEncoding = errors.New("unsupported encoding")
 )
 
 type Proxy struct {
 	TargetURL  string
 	ListenAddr string
 
+	// PodResources enables the effective resource requests/limits and QoS class columns on Pods
+	PodResources bool
+	// PodMetrics enables joining the usage from metrics.k8s.io API to Pods
+	PodMetrics bool
+	// PodEvents enables joining the Events to Pods (only the most recent Warning to Pods of a list)
+	PodEvents bool
+
+	// ColumnsFile is the file of the column sets per kind, see KindColumns
+	ColumnsFile string
+	// Kinds are the column sets per kind, loaded from ColumnsFile or from the kinds key of the config file
+	Kinds []KindColumns `mapstructure:"-"`
+
+	// ClusterName is the name of the TargetURL upstream, set in the Cluster column, default: none
+	ClusterName string
+	// Clusters are additional upstreams, routed by the /clusters/{name}/ path prefix or the X-Kubeproxy-Cluster header
+	Clusters []Cluster
+	// AggregateTimeout is the timeout of a cluster or a namespace in the fan-out list requests
+	AggregateTimeout time.Duration
+	// Namespaces are the default namespaces of the namespaces fan-out list requests
+	Namespaces []string
+	// StreamLists enables rewriting the list items one by one, without buffering the whole body
+	StreamLists bool
+	// EnrichWorkers is the number of the workers modifying the items of a list, 0: GOMAXPROCS, 1: sequential
+	EnrichWorkers int
+	// MaxBodySize is the max size of an enrichable (decompressed) body in bytes, larger ones are forwarded untouched.
+	// Streamed lists are limited by item. 0: unlimited
+	MaxBodySize int64
+	// PageSize is the default limit of the pages of the paginated list requests
+	PageSize int
+	// PaginateMaxItems is the max number of the items of a paginated list, 0: unlimited
+	PaginateMaxItems int
+	// ETag enables the ETag of the enriched responses and the 304 Not Modified responses by If-None-Match
+	ETag bool
+	// ETagAgeBucket is the time bucket of the Age column in the ETag, the ETag changes in every bucket. 0: none
+	ETagAgeBucket time.Duration
+	// CacheTTL is the lifetime of the cached responses, 0: no cache (and no coalescing)
+	CacheTTL time.Duration
+	// CacheMaxBytes is the max size of the cached response bodies
+	CacheMaxBytes int64
+	// CacheMaxEntries is the max number of the cached responses
+	CacheMaxEntries int
+	// DialTimeout, TLSHandshakeTimeout and ResponseHeaderTimeout are the timeouts of the upstream connections,
+	// 0: default
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	// RequestTimeout is the max duration of an upstream request (including the retries and the body), except watches.
+	// 0: unlimited
+	RequestTimeout time.Duration
+	// RetryMax is the max number of the retries of the idempotent upstream requests, 0: no retry
+	RetryMax int
+	// RetryBackoff is the base of the jittered exponential backoff of the retries
+	RetryBackoff time.Duration
+	// BreakerFailures is the number of the consecutive upstream failures, which opens the circuit breaker, 0: disabled
+	BreakerFailures int
+	// BreakerCooldown is the duration of the open circuit breaker, before a probe request
+	BreakerCooldown time.Duration
+	// EnrichmentWarnings adds the enrichment errors to the response in Warning header
+	EnrichmentWarnings bool
+	// EnrichmentStrict forwards a list untouched, if an item fails the enrichment.
+	// Otherwise the failed items are annotated by the Error column, the others are enriched.
+	EnrichmentStrict bool
+	// UpstreamProtobuf requests protobuf from the upstream for the GET requests of JSON clients.
+	// The protobuf responses of the built-in kinds are converted to JSON before enrichment.
+	UpstreamProtobuf bool
+
+	// Compression are the Content-Encodings of the responses (gzip, deflate, br, zstd), in order of preference, negotiated
+	// by the Accept-Encoding header of the client. Empty: no compression
+	Compression []string
+	// CompressionMinSize is the min size of a compressed body in bytes, streamed lists are always compressed
+	CompressionMinSize int
+	// CompressionLevel is the compression level (1: fastest, 9: best), 0 or -1: default
+	CompressionLevel int
+
 	HTTPServer     HTTPServer        `mapstructure:"-"`
 	ProxyTransport http.RoundTripper `mapstructure:"-"`
+	// Modifiers are the additional enrichers (for example: from RegisteredModifiers), applied in Order,
+	// together with the built-in kubectl columns. They are set at start, not reloaded.
+	Modifiers []Modifier `mapstructure:"-"`
+}
+
+// Cluster is an upstream of the proxy, with its own TargetURL and credentials
+type Cluster struct {
+	// Name of the cluster, used in the /clusters/{name}/ path prefix and in the Cluster column
+	Name      string
+	TargetURL string
+
+	// BearerToken replaces the Authorization header of the requests, if set
+	BearerToken string
+	// ForwardAuthorization forwards the Authorization header of the client, if there is no BearerToken.
+	// Otherwise the header is removed, so the client credentials aren't sent to other clusters.
+	ForwardAuthorization bool
+	// BearerTokenFile is the file of the BearerToken, read at start
+	BearerTokenFile string
+	// CAFile is the CA certificate file of the TargetURL (PEM)
+	CAFile string
+	// InsecureSkipVerify disables the verification of the TargetURL certificate
+	InsecureSkipVerify bool
 }
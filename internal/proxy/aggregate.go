@@ -0,0 +1,226 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// AggregatePathPrefix is the prefix of the fan-out list requests to all named clusters, for example:
+// curl '127.0.0.1:8003/kubeproxy-ext/v1/aggregate/api/v1/pods?kubectlSortBy=Cluster,Name'
+const AggregatePathPrefix = "/kubeproxy-ext/v1/aggregate/"
+
+// Values of the fan-out results
+const (
+	ClusterResultSuccess = "Success"
+	ClusterResultFailure = "Failure"
+)
+
+// fanOutConcurrency is the max number of the concurrent list requests of a fan-out
+const fanOutConcurrency = 16
+
+// fanOutTarget is a list request of a fan-out
+type fanOutTarget struct {
+	// name of the cluster or the namespace
+	name     string
+	up       *upstream
+	listPath string
+}
+
+// fanOutResult is the result of a target, reported in the metadata of the merged list
+type fanOutResult struct {
+	name            string
+	items           int
+	resourceVersion string
+	err             error
+	// failures are the items failed the enrichment
+	failures *enrichFailures
+}
+
+func (r *fanOutResult) toValue() map[string]interface{} {
+	value := map[string]interface{}{
+		"name":   r.name,
+		"status": ClusterResultSuccess,
+		"items":  int64(r.items),
+	}
+	if r.resourceVersion != "" {
+		value["resourceVersion"] = r.resourceVersion
+	}
+	if r.err != nil {
+		value["status"] = ClusterResultFailure
+		value["error"] = r.err.Error()
+	}
+	if r.failures != nil {
+		value["failedItems"] = int64(r.failures.failed)
+	}
+
+	return value
+}
+
+// serveAggregate sends the same list request to the named clusters concurrently, enriches the lists,
+// tags the items by the Cluster column and merges them into one list.
+// The own query parameters (filtering, sorting, etc.) are applied on the merged list.
+func (s *Service) serveAggregate(w http.ResponseWriter, r *http.Request) {
+	listPath := "/" + strings.TrimPrefix(r.URL.Path, AggregatePathPrefix)
+	names := make([]string, 0, len(s.upstreams))
+	for name := range s.upstreams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s: no named clusters", configs.ErrAggregateFailed))
+
+		return
+	}
+
+	targets := make([]fanOutTarget, 0, len(names))
+	for _, name := range names {
+		targets = append(targets, fanOutTarget{name: name, up: s.upstreams[name], listPath: listPath})
+	}
+	s.serveFanOut(w, r, targets, "clusters")
+}
+
+// serveFanOut sends the list requests concurrently, enriches and merges the lists.
+// The results of the targets are reported in the metadata of the merged list, by the resultsKey.
+// The resourceVersion of the merged list is set only if all targets have the same one.
+func (s *Service) serveFanOut(w http.ResponseWriter, r *http.Request, targets []fanOutTarget, resultsKey string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET is supported")
+
+		return
+	}
+	r, err := parseRequestOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	s.mu.RLock()
+	timeout := s.cfg.AggregateTimeout
+	s.mu.RUnlock()
+	results := make([]*fanOutResult, len(targets))
+	lists := make([]*unstructured.UnstructuredList, len(targets))
+	semaphore := make(chan struct{}, fanOutConcurrency)
+	wg := sync.WaitGroup{}
+	for i := range targets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			lists[i], results[i] = s.getFanOutList(r, targets[i], timeout)
+		}(i)
+	}
+	wg.Wait()
+
+	merged := &unstructured.UnstructuredList{Object: map[string]interface{}{}}
+	resultValues := make([]interface{}, 0, len(results))
+	resourceVersions := map[string]bool{}
+	failures := []string{}
+	var itemFailures *enrichFailures
+	for i, result := range results {
+		resultValues = append(resultValues, result.toValue())
+		if result.err != nil {
+			s.log.Error(result.err, "FanOut", resultsKey, result.name)
+			failures = append(failures, result.name+": "+result.err.Error())
+
+			continue
+		}
+		if merged.GetKind() == "" {
+			merged.SetKind(lists[i].GetKind())
+			merged.SetAPIVersion(lists[i].GetAPIVersion())
+		}
+		resourceVersions[result.resourceVersion] = true
+		itemFailures = itemFailures.merge(result.failures)
+		merged.Items = append(merged.Items, lists[i].Items...)
+	}
+	if len(failures) == len(targets) {
+		writeError(w, http.StatusBadGateway,
+			fmt.Sprintf("%s: %s", configs.ErrAggregateFailed, strings.Join(failures, "; ")))
+
+		return
+	}
+	if len(resourceVersions) == 1 {
+		for resourceVersion := range resourceVersions {
+			merged.SetResourceVersion(resourceVersion)
+		}
+	}
+	if err := unstructured.SetNestedSlice(merged.Object, resultValues, "metadata", resultsKey); err != nil {
+		s.log.Error(err, "FanOut")
+	}
+
+	body, err := s.finishList(merged, getRequestOptions(r), w.Header())
+	if err != nil {
+		s.log.Error(err, "FanOut")
+		writeError(w, listErrorCode(err), err.Error())
+
+		return
+	}
+
+	s.warnFailures(w.Header(), itemFailures)
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(body); err != nil {
+		s.log.Error(err, "FanOut")
+	}
+}
+
+// getFanOutList gets and enriches the list of a target, the items are tagged by the Cluster column (if named).
+// The timeout (if set) is applied on the additional requests (PodMetrics, Events), too.
+func (s *Service) getFanOutList(r *http.Request, target fanOutTarget, timeout time.Duration,
+) (*unstructured.UnstructuredList, *fanOutResult) {
+	result := &fanOutResult{name: target.name}
+	ctx := r.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	req := r.WithContext(context.WithValue(ctx, upstreamKey{}, target.up))
+
+	body, err := s.getUpstream(ctx, req, target.listPath, r.URL.Query())
+	if err != nil {
+		result.err = err
+
+		return nil, result
+	}
+	unstrList := &unstructured.UnstructuredList{}
+	if err := unstrList.UnmarshalJSON(body); err != nil {
+		result.err = fmt.Errorf("unmarshaljson list: %w", err)
+
+		return nil, result
+	}
+	result.items = len(unstrList.Items)
+	result.resourceVersion = unstrList.GetResourceVersion()
+	if len(unstrList.Items) == 0 {
+		return unstrList, result
+	}
+
+	enriched, failures, err := s.enrichList(req, unstrList, getRequestOptions(r), target.up.name)
+	result.failures = failures
+	if err != nil {
+		result.err = err
+
+		return nil, result
+	}
+	if !enriched && target.up.name != "" {
+		for i := range unstrList.Items {
+			err := s.addKubectlValues(&unstrList.Items[i], map[string]interface{}{ClusterColumn: target.up.name})
+			if err != nil {
+				result.err = err
+
+				return nil, result
+			}
+		}
+	}
+
+	return unstrList, result
+}
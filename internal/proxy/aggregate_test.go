@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// setAggregateClusters configures a healthy, a failing and a slow cluster besides the local one
+func (s *ServiceTestSuite) setAggregateClusters() {
+	s.T().Helper()
+	testTransport := s.service.cfg.ProxyTransport
+	cfg := s.service.cfg
+	cfg.ClusterName = "local"
+	cfg.AggregateTimeout = 200 * time.Millisecond
+	cfg.Clusters = []configs.Cluster{
+		{Name: "remote", TargetURL: "http://127.0.0.1:8002"},
+		{Name: "failing", TargetURL: "http://127.0.0.1:8009"},
+		{Name: "slow", TargetURL: "http://127.0.0.1:8010"},
+	}
+	cfg.ProxyTransport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		switch r.URL.Host {
+		case "127.0.0.1:8009":
+			return nil, errors.New("connection refused")
+		case "127.0.0.1:8010":
+			<-r.Context().Done()
+
+			return nil, r.Context().Err() // nolint:wrapcheck // OK
+		default:
+			return testTransport.RoundTrip(r) // nolint:wrapcheck // OK
+		}
+	})
+	s.setConfig(cfg)
+}
+
+func (s *ServiceTestSuite) getAggregate(reqPath string, query url.Values) (int, []byte) {
+	s.T().Helper()
+
+	return s.getEndpoint(AggregatePathPrefix+reqPath, query)
+}
+
+// getEndpoint GETs an own endpoint of the proxy and returns the status code and the body
+func (s *ServiceTestSuite) getEndpoint(reqPath string, query url.Values) (int, []byte) {
+	s.T().Helper()
+	client := HTTPClient{}
+	resp, err := client.Get(context.Background(), &(url.URL{
+		Scheme: "http", Host: s.service.cfg.ListenAddr, Path: reqPath, RawQuery: query.Encode(),
+	}))
+	require.NoError(s.T(), err, "Get")
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(s.T(), err, "ReadAll resp.Body")
+	require.NoError(s.T(), resp.Body.Close(), "Close resp.Body")
+
+	return resp.StatusCode, respBody
+}
+
+func (s *ServiceTestSuite) TestService_Aggregate() {
+	s.setAggregateClusters()
+
+	begin := time.Now()
+	statusCode, respBody := s.getAggregate("podlist-status/redis.json", url.Values{
+		KubectlSortByParam: {"Cluster,Name"}, KubectlSelectorParam: {"Status=Running"},
+	})
+	require.Less(s.T(), time.Since(begin), 2*time.Second, "slow cluster timeout")
+	require.Equal(s.T(), http.StatusOK, statusCode, "StatusCode")
+
+	unstrList := &unstructured.UnstructuredList{}
+	require.NoError(s.T(), unstrList.UnmarshalJSON(respBody), "UnmarshalJSON")
+	require.Contains(s.T(), []string{"PodList", "List"}, unstrList.GetKind(), "kind")
+	got := []string{}
+	for _, item := range unstrList.Items {
+		cluster, _, _ := unstructured.NestedString(item.Object, configs.ObjectKeyKubectl, ClusterColumn)
+		got = append(got, cluster+"/"+item.GetName())
+	}
+	require.Equal(s.T(), []string{
+		"local/rfr-vcc-0", "local/rfr-vcc-1", "local/rfs-vcc-5cc6bf796c-g9mnr", "local/rfs-vcc-5cc6bf796c-mmrkr",
+		"remote/rfr-vcc-0", "remote/rfr-vcc-1", "remote/rfs-vcc-5cc6bf796c-g9mnr", "remote/rfs-vcc-5cc6bf796c-mmrkr",
+	}, got, "items")
+
+	metadata := struct {
+		Metadata struct {
+			Clusters []map[string]interface{} `json:"clusters"`
+		} `json:"metadata"`
+	}{}
+	require.NoError(s.T(), json.Unmarshal(respBody, &metadata), "Unmarshal metadata")
+	statuses := map[string]interface{}{}
+	for _, cluster := range metadata.Metadata.Clusters {
+		statuses[cluster["name"].(string)] = cluster["status"] // nolint:forcetypeassert // test
+	}
+	require.Equal(s.T(), map[string]interface{}{
+		"local": ClusterResultSuccess, "remote": ClusterResultSuccess,
+		"failing": ClusterResultFailure, "slow": ClusterResultFailure,
+	}, statuses, "clusters")
+}
+
+func (s *ServiceTestSuite) TestService_Aggregate_Failed() {
+	s.setAggregateClusters()
+
+	statusCode, _ := s.getAggregate("podlist-status/missing.json", url.Values{})
+	require.Equal(s.T(), http.StatusBadGateway, statusCode, "all failed")
+
+	statusCode, _ = s.getAggregate("podlist-status/redis.json", url.Values{KubectlLimitParam: {"x"}})
+	require.Equal(s.T(), http.StatusBadRequest, statusCode, "invalid option")
+}
+
+func (s *ServiceTestSuite) TestService_Aggregate_NoClusters() {
+	statusCode, _ := s.getAggregate("podlist-status/redis.json", url.Values{})
+	require.Equal(s.T(), http.StatusNotFound, statusCode, "no named clusters")
+}
@@ -0,0 +1,328 @@
+package proxy
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Results of the cacheable requests
+const (
+	CacheHit       = "hit"
+	CacheMiss      = "miss"
+	CacheCoalesced = "coalesced"
+)
+
+// CacheHeader is set on the responses served by the cache: hit or coalesced
+const CacheHeader = "X-Kubeproxy-Cache"
+
+// cacheKeyHeaders are the request headers, which change the response (credentials, representation)
+var cacheKeyHeaders = []string{"Authorization", "Accept", "Accept-Encoding"} // nolint:gochecknoglobals // constant
+
+var (
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{ // nolint:gochecknoglobals // registered once
+		Namespace: metricsNamespace,
+		Name:      "cache_requests_total",
+		Help:      "Number of cacheable requests by result (hit, miss, coalesced)",
+	}, []string{"result"})
+	cacheBytes = promauto.NewGauge(prometheus.GaugeOpts{ // nolint:gochecknoglobals // registered once
+		Namespace: metricsNamespace,
+		Name:      "cache_bytes",
+		Help:      "Size of the cached response bodies",
+	})
+	cacheEntries = promauto.NewGauge(prometheus.GaugeOpts{ // nolint:gochecknoglobals // registered once
+		Namespace: metricsNamespace,
+		Name:      "cache_entries",
+		Help:      "Number of the cached responses",
+	})
+)
+
+// cachedResponse is a recorded response
+type cachedResponse struct {
+	key        string
+	statusCode int
+	header     http.Header
+	body       []byte
+	expires    time.Time
+}
+
+// write sends the recorded response. 304 Not Modified is sent, if the If-None-Match header matches the ETag.
+func (c *cachedResponse) write(w http.ResponseWriter, r *http.Request, result string) {
+	for key, values := range c.header {
+		w.Header()[key] = values
+	}
+	if result != CacheMiss {
+		w.Header().Set(CacheHeader, result)
+	}
+	etag := c.header.Get("ETag")
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if etag != "" && ifNoneMatch != "" && matchesETag(ifNoneMatch, etag) {
+		notModified.Inc()
+		for _, header := range []string{"Content-Length", "Content-Encoding", "Content-Type"} {
+			w.Header().Del(header)
+		}
+		w.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+	w.WriteHeader(c.statusCode)
+	w.Write(c.body) // nolint:errcheck,gosec // client error
+}
+
+// responseCache is an LRU cache of the responses, bounded by the size of the bodies and by the number of entries
+type responseCache struct {
+	mu         sync.Mutex
+	maxBytes   int64
+	maxEntries int
+	size       int64
+	lru        *list.List
+	entries    map[string]*list.Element
+}
+
+func newResponseCache(maxBytes int64, maxEntries int) *responseCache {
+	return &responseCache{
+		maxBytes: maxBytes, maxEntries: maxEntries,
+		lru: list.New(), entries: map[string]*list.Element{},
+	}
+}
+
+// get returns the fresh response of the key, nil if it isn't cached
+func (c *responseCache) get(key string) *cachedResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, has := c.entries[key]
+	if !has {
+		return nil
+	}
+	resp := element.Value.(*cachedResponse) // nolint:forcetypeassert // only cachedResponse
+	if time.Now().After(resp.expires) {
+		c.remove(element)
+
+		return nil
+	}
+	c.lru.MoveToFront(element)
+
+	return resp
+}
+
+// put stores the response, the least recently used ones are evicted, if the cache is full.
+// A response larger than maxBytes isn't stored.
+func (c *responseCache) put(resp *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, has := c.entries[resp.key]; has {
+		c.remove(element)
+	}
+	if int64(len(resp.body)) > c.maxBytes || c.maxEntries < 1 {
+		return
+	}
+	c.entries[resp.key] = c.lru.PushFront(resp)
+	c.size += int64(len(resp.body))
+	c.evict()
+}
+
+// resize sets the limits and evicts the entries above
+func (c *responseCache) resize(maxBytes int64, maxEntries int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxBytes = maxBytes
+	c.maxEntries = maxEntries
+	c.evict()
+}
+
+func (c *responseCache) evict() {
+	for c.lru.Len() > 0 && (c.size > c.maxBytes || c.lru.Len() > c.maxEntries) {
+		c.remove(c.lru.Back())
+	}
+	cacheBytes.Set(float64(c.size))
+	cacheEntries.Set(float64(c.lru.Len()))
+}
+
+func (c *responseCache) remove(element *list.Element) {
+	resp := c.lru.Remove(element).(*cachedResponse) // nolint:forcetypeassert // only cachedResponse
+	delete(c.entries, resp.key)
+	c.size -= int64(len(resp.body))
+	cacheBytes.Set(float64(c.size))
+	cacheEntries.Set(float64(c.lru.Len()))
+}
+
+// cacheKey is the hash of the upstream, the request URI (with the own query parameters)
+// and the headers, which change the response (see cacheKeyHeaders and the Impersonate-* headers)
+func cacheKey(r *http.Request, upstreamName string) string {
+	hash := sha256.New()
+	hash.Write([]byte(upstreamName + "\n" + r.Method + " " + r.URL.RequestURI() + "\n"))
+	names := append([]string{}, cacheKeyHeaders...)
+	for name := range r.Header {
+		if strings.HasPrefix(name, "Impersonate-") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[len(cacheKeyHeaders):])
+	for _, name := range names {
+		hash.Write([]byte(name + ": " + strings.Join(r.Header.Values(name), ", ") + "\n"))
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// cacheable returns true for the GET requests, which aren't watches and allow cached responses
+func cacheable(r *http.Request) bool {
+	cacheControl := strings.ToLower(r.Header.Get("Cache-Control"))
+
+	return r.Method == http.MethodGet && !isWatch(r) &&
+		!strings.Contains(cacheControl, "no-cache") && !strings.Contains(cacheControl, "no-store")
+}
+
+// serveCached serves the request from the cache (CacheTTL), or by the next handler.
+// The concurrent identical requests are coalesced: one of them calls the next handler, the others wait for it.
+// Only the 200 OK responses without Set-Cookie are stored. The responses larger than CacheMaxBytes or MaxBodySize
+// and the untouched (skipped) responses aren't recorded, but sent to the client directly,
+// the coalesced requests of them call the next handler, too.
+func (s *Service) serveCached(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	s.mu.RLock()
+	ttl := s.cfg.CacheTTL
+	limit := s.cfg.CacheMaxBytes
+	s.mu.RUnlock()
+	if maxBody := s.maxBodySize(); maxBody > 0 && maxBody < limit {
+		limit = maxBody
+	}
+	if ttl <= 0 || !cacheable(r) {
+		next(w, r)
+
+		return
+	}
+
+	key := cacheKey(r, s.upstreamOf(r).name)
+	if resp := s.cache.get(key); resp != nil {
+		cacheRequests.WithLabelValues(CacheHit).Inc()
+		resp.write(w, r, CacheHit)
+
+		return
+	}
+
+	executed := false
+	value, _, _ := s.flight.Do(key, func() (interface{}, error) {
+		executed = true
+		// The shared request isn't canceled by the client of the first request
+		leaderReq := r.Clone(detachedContext{r.Context()})
+		leaderReq.Header.Del("If-None-Match")
+		recorder := newResponseRecorder(w, limit)
+		next(recorder, leaderReq)
+		if recorder.passedThrough {
+			return (*cachedResponse)(nil), nil
+		}
+		resp := &cachedResponse{
+			key: key, statusCode: recorder.statusCode, header: recorder.header,
+			body: recorder.body.Bytes(), expires: time.Now().Add(ttl),
+		}
+		if resp.statusCode == http.StatusOK && resp.header.Get("Set-Cookie") == "" {
+			s.cache.put(resp)
+		}
+
+		return resp, nil
+	})
+	resp := value.(*cachedResponse) // nolint:forcetypeassert // only cachedResponse
+	result := CacheCoalesced
+	if executed {
+		result = CacheMiss
+	}
+	if resp == nil {
+		cacheRequests.WithLabelValues(CacheMiss).Inc()
+		if !executed {
+			next(w, r)
+		}
+
+		return
+	}
+	cacheRequests.WithLabelValues(result).Inc()
+	resp.write(w, r, result)
+}
+
+// detachedContext keeps the values of the parent context, but it's never canceled
+type detachedContext struct {
+	context.Context // nolint:containedctx // values only
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// responseRecorder records a response in memory. If the body is larger than the limit,
+// or the response is forwarded untouched (EnrichmentSkipped), the response is passed through to w.
+type responseRecorder struct {
+	statusCode    int
+	header        http.Header
+	body          bytes.Buffer
+	wroteHeader   bool
+	limit         int64
+	w             http.ResponseWriter
+	passedThrough bool
+}
+
+func newResponseRecorder(w http.ResponseWriter, limit int64) *responseRecorder {
+	return &responseRecorder{statusCode: http.StatusOK, header: http.Header{}, w: w, limit: limit}
+}
+
+func (r *responseRecorder) Header() http.Header {
+	if r.passedThrough {
+		return r.w.Header()
+	}
+
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.statusCode = statusCode
+	if strings.HasPrefix(r.header.Get(EnrichmentHeader), "skipped") {
+		r.passThrough() // nolint:errcheck,gosec // client error
+	}
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	if !r.passedThrough && int64(r.body.Len()+len(data)) > r.limit {
+		if err := r.passThrough(); err != nil {
+			return 0, err
+		}
+	}
+	if r.passedThrough {
+		return r.w.Write(data) // nolint:wrapcheck // transparent
+	}
+
+	return r.body.Write(data) // nolint:wrapcheck // never fails
+}
+
+// passThrough sends the recorded part of the response, the rest is written to w directly
+func (r *responseRecorder) passThrough() error {
+	r.passedThrough = true
+	for key, values := range r.header {
+		r.w.Header()[key] = values
+	}
+	r.w.WriteHeader(r.statusCode)
+	_, err := r.w.Write(r.body.Bytes())
+	r.body = bytes.Buffer{}
+
+	return err // nolint:wrapcheck // transparent
+}
+
+// Flush is called by the streaming ReverseProxy. The recorded response is sent after it's recorded completely,
+// the passed through one is flushed.
+func (r *responseRecorder) Flush() {
+	if flusher, is := r.w.(http.Flusher); is && r.passedThrough {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func (s *ServiceTestSuite) TestResponseCache() {
+	cache := newResponseCache(10, 2)
+	cache.put(&cachedResponse{key: "a", body: []byte("1234"), expires: time.Now().Add(time.Minute)})
+	cache.put(&cachedResponse{key: "b", body: []byte("1234"), expires: time.Now().Add(time.Minute)})
+	require.NotNil(s.T(), cache.get("a"), "a")
+	cache.put(&cachedResponse{key: "c", body: []byte("1234"), expires: time.Now().Add(time.Minute)})
+	require.Nil(s.T(), cache.get("b"), "evicted by entries (least recently used)")
+	require.NotNil(s.T(), cache.get("a"), "a kept")
+
+	cache.put(&cachedResponse{key: "d", body: []byte("12345678"), expires: time.Now().Add(time.Minute)})
+	require.Equal(s.T(), 1, cache.lru.Len(), "evicted by bytes")
+	require.Equal(s.T(), int64(8), cache.size, "size")
+
+	cache.put(&cachedResponse{key: "e", body: []byte("12345678901"), expires: time.Now().Add(time.Minute)})
+	require.Nil(s.T(), cache.get("e"), "too large")
+
+	cache.put(&cachedResponse{key: "f", body: []byte("1"), expires: time.Now().Add(-time.Second)})
+	require.Nil(s.T(), cache.get("f"), "expired")
+
+	cache.resize(10, 0)
+	require.Equal(s.T(), 0, cache.lru.Len(), "resized")
+	require.Equal(s.T(), int64(0), cache.size, "resized size")
+}
+
+func (s *ServiceTestSuite) TestCacheKey() {
+	newReq := func(target string, headers map[string]string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, target, http.NoBody)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+
+		return req
+	}
+	key := cacheKey(newReq("/api/v1/pods?kubectlSortBy=Name", map[string]string{"Authorization": "Bearer a"}), "")
+	require.Equal(s.T(), key,
+		cacheKey(newReq("/api/v1/pods?kubectlSortBy=Name", map[string]string{"Authorization": "Bearer a"}), ""), "same")
+	for name, req := range map[string]*http.Request{
+		"query":       newReq("/api/v1/pods?kubectlSortBy=Age", map[string]string{"Authorization": "Bearer a"}),
+		"credentials": newReq("/api/v1/pods?kubectlSortBy=Name", map[string]string{"Authorization": "Bearer b"}),
+		"impersonate": newReq("/api/v1/pods?kubectlSortBy=Name", map[string]string{
+			"Authorization": "Bearer a", "Impersonate-User": "admin",
+		}),
+		"encoding": newReq("/api/v1/pods?kubectlSortBy=Name", map[string]string{
+			"Authorization": "Bearer a", "Accept-Encoding": "gzip",
+		}),
+	} {
+		require.NotEqual(s.T(), key, cacheKey(req, ""), name)
+	}
+	require.NotEqual(s.T(), key,
+		cacheKey(newReq("/api/v1/pods?kubectlSortBy=Name", map[string]string{"Authorization": "Bearer a"}), "remote"),
+		"cluster")
+
+	require.False(s.T(), cacheable(newReq("/api/v1/pods?watch=true", nil)), "watch")
+	require.False(s.T(), cacheable(newReq("/api/v1/pods", map[string]string{"Cache-Control": "no-cache"})), "no-cache")
+	require.True(s.T(), cacheable(newReq("/api/v1/pods", nil)), "list")
+}
+
+// setCountingTransport counts the upstream requests, the requests wait for the release, if it's set
+func (s *ServiceTestSuite) setCountingTransport(ttl time.Duration, release chan struct{}) *int32 {
+	s.T().Helper()
+	testTransport := s.service.cfg.ProxyTransport
+	count := int32(0)
+	cfg := s.service.cfg
+	cfg.CacheTTL = ttl
+	cfg.CacheMaxBytes = 1024 * 1024
+	cfg.CacheMaxEntries = 10
+	cfg.ProxyTransport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&count, 1)
+		if release != nil {
+			<-release
+		}
+
+		return testTransport.RoundTrip(r) // nolint:wrapcheck // OK
+	})
+	s.setConfig(cfg)
+
+	return &count
+}
+
+func (s *ServiceTestSuite) TestService_Cache() {
+	count := s.setCountingTransport(time.Minute, nil)
+
+	wantBody, resp := s.getBody("/podlist-status/redis.json", nil)
+	require.Empty(s.T(), resp.Header.Get(CacheHeader), "miss")
+	gotBody, resp := s.getBody("/podlist-status/redis.json", nil)
+	require.Equal(s.T(), CacheHit, resp.Header.Get(CacheHeader), "hit")
+	require.Equal(s.T(), wantBody, gotBody, "cached body")
+	require.Equal(s.T(), int32(1), atomic.LoadInt32(count), "upstream requests")
+
+	s.getBody("/podlist-status/mongo.json", nil)
+	require.Equal(s.T(), int32(2), atomic.LoadInt32(count), "other path")
+}
+
+func (s *ServiceTestSuite) TestService_Cache_Disabled() {
+	count := s.setCountingTransport(0, nil)
+	s.getBody("/podlist-status/redis.json", nil)
+	s.getBody("/podlist-status/redis.json", nil)
+	require.Equal(s.T(), int32(2), atomic.LoadInt32(count), "upstream requests")
+}
+
+func (s *ServiceTestSuite) TestService_Cache_Coalesced() {
+	release := make(chan struct{})
+	count := s.setCountingTransport(time.Minute, release)
+
+	const clients = 5
+	bodies := make([][]byte, clients)
+	wg := sync.WaitGroup{}
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bodies[i], _ = s.getBody("/podlist-status/redis.json", nil)
+		}(i)
+	}
+	require.Eventually(s.T(), func() bool { return atomic.LoadInt32(count) == 1 }, time.Second, time.Millisecond,
+		"first request")
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	require.Equal(s.T(), int32(1), atomic.LoadInt32(count), "upstream requests")
+	for i := 1; i < clients; i++ {
+		require.Equal(s.T(), bodies[0], bodies[i], "body")
+	}
+}
+
+func (s *ServiceTestSuite) TestCachedResponse_NotModified() {
+	resp := &cachedResponse{
+		statusCode: http.StatusOK, body: []byte("{}"),
+		header: http.Header{"Etag": []string{`W/"100-abc"`}, "Content-Type": []string{"application/json"}},
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/api/v1/pods", http.NoBody)
+	require.NoError(s.T(), err, "NewRequest")
+	req.Header.Set("If-None-Match", `W/"100-abc"`)
+	recorder := httptest.NewRecorder()
+	resp.write(recorder, req, CacheHit)
+	require.Equal(s.T(), http.StatusNotModified, recorder.Code, "304")
+	require.Empty(s.T(), recorder.Body.Bytes(), "Body")
+	require.Equal(s.T(), CacheHit, recorder.Header().Get(CacheHeader), CacheHeader)
+}
+
+func (s *ServiceTestSuite) TestService_Cache_TooLarge() {
+	count := s.setCountingTransport(time.Minute, nil)
+	s.service.cfg.CacheMaxBytes = 100
+
+	wantBody, resp := s.getBody("/podlist-status/redis.json", nil)
+	require.Greater(s.T(), len(wantBody), 100, "body")
+	require.Empty(s.T(), resp.Header.Get(CacheHeader), "passed through")
+	gotBody, resp := s.getBody("/podlist-status/redis.json", nil)
+	require.Empty(s.T(), resp.Header.Get(CacheHeader), "not cached")
+	require.Equal(s.T(), wantBody, gotBody, "body")
+	require.Equal(s.T(), int32(2), atomic.LoadInt32(count), "upstream requests")
+	require.Equal(s.T(), 0, s.service.cache.lru.Len(), "entries")
+}
+
+func (s *ServiceTestSuite) TestService_Cache_Skipped() {
+	count := s.setCountingTransport(time.Minute, nil)
+	atomic.StoreInt64(&s.service.maxBody, 100)
+
+	_, resp := s.getBody("/podlist-status/redis.json", nil)
+	require.Equal(s.T(), EnrichmentSkipped, resp.Header.Get(EnrichmentHeader), EnrichmentHeader)
+	s.getBody("/podlist-status/redis.json", nil)
+	require.Equal(s.T(), int32(2), atomic.LoadInt32(count), "upstream requests")
+}
+
+func (s *ServiceTestSuite) TestResponseRecorder_PassThrough() {
+	w := httptest.NewRecorder()
+	recorder := newResponseRecorder(w, 4)
+	recorder.Header().Set("Content-Type", "text/plain")
+	_, err := recorder.Write([]byte("123"))
+	require.NoError(s.T(), err, "Write")
+	require.False(s.T(), recorder.passedThrough, "recorded")
+	_, err = recorder.Write([]byte("45"))
+	require.NoError(s.T(), err, "Write")
+	require.True(s.T(), recorder.passedThrough, "passed through")
+	require.Equal(s.T(), "12345", w.Body.String(), "Body")
+	require.Equal(s.T(), "text/plain", w.Header().Get("Content-Type"), "Content-Type")
+	require.Zero(s.T(), recorder.body.Len(), "not recorded")
+}
@@ -0,0 +1,319 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// Routing to the upstreams (clusters), for example:
+// curl '127.0.0.1:8003/clusters/prod/api/v1/namespaces/redis/pods'
+// curl -H 'X-Kubeproxy-Cluster: prod' '127.0.0.1:8003/api/v1/namespaces/redis/pods'
+const (
+	ClustersPathPrefix = "/clusters/"
+	ClusterHeader      = "X-Kubeproxy-Cluster"
+)
+
+// ClusterColumn is the name of the upstream (cluster), added to the kubectl columns of the enriched items
+const ClusterColumn = "Cluster"
+
+// ClustersPath is the health of the upstreams, for example:
+// curl '127.0.0.1:8003/kubeproxy-ext/v1/clusters'
+const ClustersPath = "/kubeproxy-ext/v1/clusters"
+
+// Values of the upstream health
+const (
+	UpstreamUnknown   = "Unknown"
+	UpstreamHealthy   = "Healthy"
+	UpstreamUnhealthy = "Unhealthy"
+)
+
+var upstreamUp = promauto.NewGaugeVec(prometheus.GaugeOpts{ // nolint:gochecknoglobals // registered once
+	Namespace: metricsNamespace,
+	Name:      "upstream_up",
+	Help:      "Health of the upstream by the last request (1: healthy, 0: unhealthy)",
+}, []string{"cluster"})
+
+// upstream is a target of the proxy
+type upstream struct {
+	name      string
+	targetURL *url.URL
+	proxy     *httputil.ReverseProxy
+	client    *http.Client
+	health    *upstreamHealth
+}
+
+// UpstreamHealth is the health of an upstream, tracked by the forwarded and additional requests.
+// Responses with 5xx status are failures.
+type UpstreamHealth struct {
+	Name                string     `json:"name"`
+	TargetURL           string     `json:"targetURL"`
+	Status              string     `json:"status"`
+	LastStatusCode      int        `json:"lastStatusCode,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+	LastSeen            *time.Time `json:"lastSeen,omitempty"`
+	LastSuccess         *time.Time `json:"lastSuccess,omitempty"`
+	ConsecutiveFailures int64      `json:"consecutiveFailures"`
+}
+
+type upstreamHealth struct {
+	mu    sync.Mutex
+	state UpstreamHealth
+}
+
+func (h *upstreamHealth) observe(resp *http.Response, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	h.state.LastSeen = &now
+	h.state.LastStatusCode = 0
+	h.state.LastError = ""
+	switch {
+	case err != nil:
+		h.state.LastError = err.Error()
+	case resp.StatusCode >= http.StatusInternalServerError:
+		h.state.LastStatusCode = resp.StatusCode
+		h.state.LastError = resp.Status
+	default:
+		h.state.LastStatusCode = resp.StatusCode
+		h.state.LastSuccess = h.state.LastSeen
+		h.state.ConsecutiveFailures = 0
+		h.state.Status = UpstreamHealthy
+		upstreamUp.WithLabelValues(h.state.Name).Set(1)
+
+		return
+	}
+	h.state.ConsecutiveFailures++
+	h.state.Status = UpstreamUnhealthy
+	upstreamUp.WithLabelValues(h.state.Name).Set(0)
+}
+
+func (h *upstreamHealth) get() UpstreamHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.state
+}
+
+// healthTransport tracks the health of the upstream
+type healthTransport struct {
+	next   http.RoundTripper
+	health *upstreamHealth
+}
+
+func (t *healthTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(r)
+	t.health.observe(resp, err)
+
+	return resp, err // nolint:wrapcheck // transparent
+}
+
+// bearerTransport replaces the Authorization header by the credentials of the cluster,
+// or removes it, if the token is empty
+type bearerTransport struct {
+	next  http.RoundTripper
+	token string
+}
+
+func (t *bearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	if t.token == "" {
+		r.Header.Del("Authorization")
+	} else {
+		r.Header.Set("Authorization", "Bearer "+t.token)
+	}
+
+	return t.next.RoundTrip(r) // nolint:wrapcheck // transparent
+}
+
+// newUpstream creates the proxy and the client of an upstream.
+// The transport of the config (for tests) is used for all upstreams, if set.
+func (s *Service) newUpstream(cluster configs.Cluster) (*upstream, error) {
+	targetURL, err := url.Parse(cluster.TargetURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: targeturl: %s", configs.ErrInvalidCluster, cluster.Name, err)
+	}
+
+	transport := s.cfg.ProxyTransport
+	if transport == nil {
+		if transport, err = newClusterTransport(cluster, s.cfg, s.log); err != nil {
+			return nil, err
+		}
+	}
+	token := cluster.BearerToken
+	if cluster.BearerTokenFile != "" {
+		tokenBytes, err := os.ReadFile(cluster.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: bearertokenfile: %s", configs.ErrInvalidCluster, cluster.Name, err)
+		}
+		token = strings.TrimSpace(string(tokenBytes))
+	}
+	if token != "" || !cluster.ForwardAuthorization {
+		transport = &bearerTransport{next: transport, token: token}
+	}
+
+	up := &upstream{
+		name:      cluster.Name,
+		targetURL: targetURL,
+		health: &upstreamHealth{state: UpstreamHealth{
+			Name: cluster.Name, TargetURL: cluster.TargetURL, Status: UpstreamUnknown,
+		}},
+	}
+	transport = &retryTransport{
+		next: transport, policy: s.getRetryPolicy, breaker: &circuitBreaker{name: cluster.Name},
+	}
+	transport = &healthTransport{next: transport, health: up.health}
+	up.proxy = httputil.NewSingleHostReverseProxy(targetURL)
+	up.proxy.Transport = transport
+	up.proxy.ModifyResponse = s.ModifyResponse
+	up.proxy.ErrorHandler = s.proxyErrorHandler
+	up.client = &http.Client{Transport: transport}
+
+	return up, nil
+}
+
+// newClusterTransport creates the TLS transport of a cluster, with the connection timeouts of the config
+func newClusterTransport(cluster configs.Cluster, cfg configs.Proxy, log logr.Logger) (http.RoundTripper, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone() // nolint:forcetypeassert // standard library
+	if cfg.DialTimeout > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   cfg.DialTimeout,
+			KeepAlive: 30 * time.Second, // nolint:gomnd // same to http.DefaultTransport
+		}).DialContext
+	}
+	if cfg.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	}
+	transport.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout
+	if cluster.CAFile != "" || cluster.InsecureSkipVerify {
+		tlsConfig := &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: cluster.InsecureSkipVerify, // nolint:gosec // configured
+		}
+		if cluster.CAFile != "" {
+			caPEM, err := os.ReadFile(cluster.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: cafile: %s", configs.ErrInvalidCluster, cluster.Name, err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+				return nil, fmt.Errorf("%w: %s: cafile: no certificate", configs.ErrInvalidCluster, cluster.Name)
+			}
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &DebugTransport{log: log, transport: transport}, nil
+}
+
+// newUpstreams creates the default upstream (TargetURL) and the upstreams of the clusters.
+// The Authorization header of the client is forwarded to the default upstream.
+func (s *Service) newUpstreams() error {
+	var err error
+	if s.defaultUpstream, err = s.newUpstream(configs.Cluster{
+		Name: s.cfg.ClusterName, TargetURL: s.cfg.TargetURL, ForwardAuthorization: true,
+	}); err != nil {
+		return err
+	}
+
+	s.upstreams = map[string]*upstream{}
+	if s.cfg.ClusterName != "" {
+		s.upstreams[s.cfg.ClusterName] = s.defaultUpstream
+	}
+	for _, cluster := range s.cfg.Clusters {
+		if cluster.Name == "" || strings.Contains(cluster.Name, "/") {
+			return fmt.Errorf("%w: invalid name: '%s'", configs.ErrInvalidCluster, cluster.Name)
+		}
+		if _, has := s.upstreams[cluster.Name]; has {
+			return fmt.Errorf("%w: duplicated name: %s", configs.ErrInvalidCluster, cluster.Name)
+		}
+		if s.upstreams[cluster.Name], err = s.newUpstream(cluster); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type upstreamKey struct{}
+
+// routeUpstream selects the upstream by the path prefix or by the header, and removes them from the request
+func (s *Service) routeUpstream(r *http.Request) (*http.Request, error) {
+	name := ""
+	if strings.HasPrefix(r.URL.Path, ClustersPathPrefix) {
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, ClustersPathPrefix), "/", 2) // nolint:gomnd // name/path
+		name = parts[0]
+		reqURL := *r.URL
+		reqURL.Path = "/"
+		if len(parts) > 1 {
+			reqURL.Path += parts[1]
+		}
+		reqURL.RawPath = ""
+		r = r.Clone(r.Context())
+		r.URL = &reqURL
+		r.RequestURI = r.URL.RequestURI()
+	} else if name = r.Header.Get(ClusterHeader); name != "" {
+		r = r.Clone(r.Context())
+		r.Header.Del(ClusterHeader)
+	}
+
+	up := s.defaultUpstream
+	if name != "" {
+		var has bool
+		if up, has = s.upstreams[name]; !has {
+			return r, fmt.Errorf("%w: %s", configs.ErrUnknownCluster, name)
+		}
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), upstreamKey{}, up)), nil
+}
+
+// upstreamOf returns the upstream of the request, the request can be nil
+func (s *Service) upstreamOf(req *http.Request) *upstream {
+	if req != nil {
+		if up, is := req.Context().Value(upstreamKey{}).(*upstream); is {
+			return up
+		}
+	}
+
+	return s.defaultUpstream
+}
+
+// serveClusters returns the health of the upstreams
+func (s *Service) serveClusters(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(s.upstreams))
+	for name := range s.upstreams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	healths := []UpstreamHealth{}
+	if s.cfg.ClusterName == "" {
+		healths = append(healths, s.defaultUpstream.health.get())
+	}
+	for _, name := range names {
+		healths = append(healths, s.upstreams[name].health.get())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(healths); err != nil {
+		s.log.Error(err, "Clusters")
+	}
+}
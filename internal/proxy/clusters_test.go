@@ -0,0 +1,257 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+func (s *ServiceTestSuite) setClusters() {
+	s.T().Helper()
+	cfg := s.service.cfg
+	cfg.ClusterName = "local"
+	cfg.Clusters = []configs.Cluster{
+		{Name: "remote", TargetURL: "http://127.0.0.1:8002", BearerToken: "remote-token"},
+	}
+	s.setConfig(cfg)
+}
+
+func (s *ServiceTestSuite) TestService_Proxy_Clusters() {
+	s.setClusters()
+	transport, is := s.service.cfg.ProxyTransport.(*TestTransport)
+	require.True(s.T(), is, "TestTransport")
+
+	tests := []struct {
+		name        string
+		reqPath     string
+		header      string
+		wantCluster string
+		wantHost    string
+	}{
+		{
+			name:        "Default",
+			reqPath:     "/pod-status/Running2.json",
+			wantCluster: "local",
+			wantHost:    "127.0.0.1:8001",
+		},
+		{
+			name:        "Default by path",
+			reqPath:     "/clusters/local/pod-status/Running2.json",
+			wantCluster: "local",
+			wantHost:    "127.0.0.1:8001",
+		},
+		{
+			name:        "Path",
+			reqPath:     "/clusters/remote/pod-status/Running2.json",
+			wantCluster: "remote",
+			wantHost:    "127.0.0.1:8002",
+		},
+		{
+			name:        "Header",
+			reqPath:     "/podlist-status/redis.json",
+			header:      "remote",
+			wantCluster: "remote",
+			wantHost:    "127.0.0.1:8002",
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+				(&url.URL{Scheme: "http", Host: s.service.cfg.ListenAddr, Path: tc.reqPath}).String(), http.NoBody)
+			require.NoError(s.T(), err, "NewRequest")
+			if tc.header != "" {
+				req.Header.Set(ClusterHeader, tc.header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(s.T(), err, "Do")
+			require.Equal(s.T(), http.StatusOK, resp.StatusCode, "StatusCode")
+			respBody, err := io.ReadAll(resp.Body)
+			require.NoError(s.T(), err, "ReadAll resp.Body")
+			require.NoError(s.T(), resp.Body.Close(), "Close resp.Body")
+
+			list := struct {
+				Items []map[string]interface{} `json:"items"`
+			}{}
+			require.NoError(s.T(), json.Unmarshal(respBody, &list), "Unmarshal")
+			items := list.Items
+			if len(items) == 0 {
+				item := map[string]interface{}{}
+				require.NoError(s.T(), json.Unmarshal(respBody, &item), "Unmarshal")
+				items = append(items, item)
+			}
+			for _, item := range items {
+				kubectlMap, is := item[configs.ObjectKeyKubectl].(map[string]interface{})
+				require.True(s.T(), is, configs.ObjectKeyKubectl)
+				require.Equal(s.T(), tc.wantCluster, kubectlMap[ClusterColumn], ClusterColumn)
+			}
+			require.Equal(s.T(), tc.wantHost, transport.getLastURL().Host, "Host")
+			require.NotContains(s.T(), transport.getLastURL().Path, ClustersPathPrefix, "Path")
+		})
+	}
+}
+
+func (s *ServiceTestSuite) TestService_Proxy_Clusters_Authorization() {
+	cfg := s.service.cfg
+	cfg.Clusters = []configs.Cluster{
+		{Name: "remote", TargetURL: "http://127.0.0.1:8002", BearerToken: "remote-token"},
+		{Name: "open", TargetURL: "http://127.0.0.1:8003"},
+		{Name: "trusted", TargetURL: "http://127.0.0.1:8004", ForwardAuthorization: true},
+	}
+	gotAuthorization := map[string]string{}
+	cfg.ProxyTransport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		gotAuthorization[r.URL.Host] = r.Header.Get("Authorization")
+
+		return newTestResponse(r, http.StatusOK, `{"kind":"Status","apiVersion":"v1"}`), nil
+	})
+	s.setConfig(cfg)
+
+	tests := []struct {
+		name    string
+		cluster string
+		host    string
+		want    string
+	}{
+		{name: "Default", host: "127.0.0.1:8001", want: "Bearer client-token"},
+		{name: "BearerToken", cluster: "remote", host: "127.0.0.1:8002", want: "Bearer remote-token"},
+		{name: "No credentials", cluster: "open", host: "127.0.0.1:8003", want: ""},
+		{name: "ForwardAuthorization", cluster: "trusted", host: "127.0.0.1:8004", want: "Bearer client-token"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+				(&url.URL{Scheme: "http", Host: s.service.cfg.ListenAddr, Path: "/api/v1/status"}).String(), http.NoBody)
+			require.NoError(s.T(), err, "NewRequest")
+			req.Header.Set("Authorization", "Bearer client-token")
+			if tc.cluster != "" {
+				req.Header.Set(ClusterHeader, tc.cluster)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(s.T(), err, "Do")
+			require.NoError(s.T(), resp.Body.Close(), "Close resp.Body")
+			require.Equal(s.T(), http.StatusOK, resp.StatusCode, "StatusCode")
+
+			got, has := gotAuthorization[tc.host]
+			require.True(s.T(), has, "forwarded")
+			require.Equal(s.T(), tc.want, got, "Authorization")
+		})
+	}
+}
+
+func (s *ServiceTestSuite) TestService_Proxy_Clusters_Unknown() {
+	s.setClusters()
+	client := HTTPClient{}
+	resp, err := client.Get(context.Background(),
+		&(url.URL{Scheme: "http", Host: s.service.cfg.ListenAddr, Path: "/clusters/unknown/api/v1/pods"}))
+	require.NoError(s.T(), err, "Get")
+	require.NoError(s.T(), resp.Body.Close(), "Close resp.Body")
+	require.Equal(s.T(), http.StatusNotFound, resp.StatusCode, "StatusCode")
+}
+
+func (s *ServiceTestSuite) TestService_New_InvalidClusters() {
+	tests := []struct {
+		name     string
+		clusters []configs.Cluster
+	}{
+		{name: "Missing name", clusters: []configs.Cluster{{TargetURL: "http://127.0.0.1:8002"}}},
+		{name: "Duplicated name", clusters: []configs.Cluster{
+			{Name: "a", TargetURL: "http://127.0.0.1:8002"}, {Name: "a", TargetURL: "http://127.0.0.1:8003"},
+		}},
+		{name: "Invalid TargetURL", clusters: []configs.Cluster{{Name: "a", TargetURL: "http://[::1"}}},
+		{name: "Missing BearerTokenFile", clusters: []configs.Cluster{
+			{Name: "a", TargetURL: "http://127.0.0.1:8002", BearerTokenFile: "../../test/missing"},
+		}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			cfg := s.service.cfg
+			cfg.Clusters = tc.clusters
+			_, err := New(cfg, s.service.log)
+			require.ErrorIs(s.T(), err, configs.ErrInvalidCluster, "New")
+		})
+	}
+}
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func (s *ServiceTestSuite) TestService_UpstreamHealth() {
+	health := &upstreamHealth{state: UpstreamHealth{Name: "test", Status: UpstreamUnknown}}
+	var gotAuthorization string
+	statusCode := http.StatusOK
+	var transportErr error
+	transport := &healthTransport{health: health, next: &bearerTransport{token: "test-token",
+		next: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			gotAuthorization = r.Header.Get("Authorization")
+			if transportErr != nil {
+				return nil, transportErr
+			}
+
+			return &http.Response{StatusCode: statusCode, Status: http.StatusText(statusCode), Body: http.NoBody}, nil
+		}),
+	}}
+	get := func() {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://127.0.0.1:8001/", http.NoBody)
+		require.NoError(s.T(), err, "NewRequest")
+		req.Header.Set("Authorization", "Bearer client-token")
+		if resp, err := transport.RoundTrip(req); err == nil {
+			require.NoError(s.T(), resp.Body.Close(), "Close resp.Body")
+		}
+	}
+
+	get()
+	require.Equal(s.T(), "Bearer test-token", gotAuthorization, "Authorization")
+	require.Equal(s.T(), UpstreamHealthy, health.get().Status, "OK")
+
+	statusCode = http.StatusNotFound
+	get()
+	require.Equal(s.T(), UpstreamHealthy, health.get().Status, "NotFound")
+
+	statusCode = http.StatusServiceUnavailable
+	get()
+	transportErr = errors.New("connection refused")
+	get()
+	state := health.get()
+	require.Equal(s.T(), UpstreamUnhealthy, state.Status, "Unavailable")
+	require.Equal(s.T(), int64(2), state.ConsecutiveFailures, "ConsecutiveFailures")
+	require.Equal(s.T(), "connection refused", state.LastError, "LastError")
+
+	transportErr = nil
+	statusCode = http.StatusOK
+	get()
+	require.Equal(s.T(), UpstreamHealthy, health.get().Status, "Recovered")
+	require.Equal(s.T(), int64(0), health.get().ConsecutiveFailures, "Recovered ConsecutiveFailures")
+}
+
+func (s *ServiceTestSuite) TestService_Proxy_ClustersHealth() {
+	s.setClusters()
+	_ = s.getKubectlMaps("/clusters/remote/pod-status/Running2.json", url.Values{})
+
+	client := HTTPClient{}
+	resp, err := client.Get(context.Background(),
+		&(url.URL{Scheme: "http", Host: s.service.cfg.ListenAddr, Path: ClustersPath}))
+	require.NoError(s.T(), err, "Get")
+	require.Equal(s.T(), http.StatusOK, resp.StatusCode, "StatusCode")
+	healths := []UpstreamHealth{}
+	require.NoError(s.T(), json.NewDecoder(resp.Body).Decode(&healths), "Decode")
+	require.NoError(s.T(), resp.Body.Close(), "Close resp.Body")
+
+	require.Len(s.T(), healths, 2, "healths")
+	require.Equal(s.T(), "local", healths[0].Name, "local")
+	require.Equal(s.T(), UpstreamUnknown, healths[0].Status, "local")
+	require.Equal(s.T(), "remote", healths[1].Name, "remote")
+	require.Equal(s.T(), UpstreamHealthy, healths[1].Status, "remote")
+	require.Equal(s.T(), http.StatusOK, healths[1].LastStatusCode, "remote")
+}
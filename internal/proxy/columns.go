@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/jsonpath"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// Query parameters for custom columns (same to `kubectl get -o custom-columns=`), for example:
+// curl '127.0.0.1:8003/api/v1/pods?kubectlColumns=Image:.spec.containers[*].image,Phase:.status.phase'
+// curl '127.0.0.1:8003/api/v1/pods?kubectlColumns=Name:.metadata.name,Image:.spec.containers[*].image&kubectlOutput=columns'
+const (
+	KubectlColumnsParam = "kubectlColumns"
+	KubectlOutputParam  = "kubectlOutput"
+)
+
+// KubectlOutputColumns returns only the custom columns of the items (a JSON array for lists)
+const KubectlOutputColumns = "columns"
+
+// customColumn is a named JSONPath expression, validated by newCustomColumn
+type customColumn struct {
+	name     string
+	template string
+}
+
+// parseCustomColumns parses the `kubectl get -o custom-columns=` format: <name>:<jsonpath>[,<name>:<jsonpath>]
+func parseCustomColumns(text string) ([]*customColumn, error) {
+	columns := []*customColumn{}
+	for _, spec := range strings.Split(text, ",") {
+		parts := strings.SplitN(spec, ":", 2) // nolint:gomnd // name and template
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("%w: %s", configs.ErrInvalidKubectlColumns, spec)
+		}
+		column, err := newCustomColumn(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+
+	return columns, nil
+}
+
+func newCustomColumn(name string, template string) (*customColumn, error) {
+	column := &customColumn{
+		name:     name,
+		template: relaxedJSONPathExpression(template),
+	}
+	if _, err := column.parse(); err != nil {
+		return nil, fmt.Errorf("%w: %s: %s", configs.ErrInvalidKubectlColumns, name, err)
+	}
+
+	return column, nil
+}
+
+// parse returns a new parsed JSONPath of the template
+func (c *customColumn) parse() (*jsonpath.JSONPath, error) {
+	jsonPath := jsonpath.New(c.name).AllowMissingKeys(true)
+	if err := jsonPath.Parse(c.template); err != nil {
+		return nil, err // nolint:wrapcheck // wrapped by the caller
+	}
+
+	return jsonPath, nil
+}
+
+// relaxedJSONPathExpression accepts the relaxed kubectl syntax: .metadata.name, metadata.name, {.metadata.name}
+func relaxedJSONPathExpression(template string) string {
+	if strings.HasPrefix(template, "{") {
+		return template
+	}
+	if !strings.HasPrefix(template, ".") {
+		template = "." + template
+	}
+
+	return "{" + template + "}"
+}
+
+// evaluate returns the value of the column. A missing value is <none>, multiple values are joined by comma.
+// The parsed JSONPath is modified by the evaluation of range, so it's parsed by each evaluation
+// (the items can be modified concurrently).
+func (c *customColumn) evaluate(item *unstructured.Unstructured) (interface{}, error) {
+	jsonPath, err := c.parse()
+	if err != nil {
+		return nil, fmt.Errorf("jsonpath %s: %w", c.name, err)
+	}
+	results, err := jsonPath.FindResults(item.UnstructuredContent())
+	if err != nil {
+		return nil, fmt.Errorf("jsonpath %s: %w", c.name, err)
+	}
+
+	values := []interface{}{}
+	for _, result := range results {
+		for _, value := range result {
+			if value.IsValid() && value.CanInterface() && value.Interface() != nil {
+				values = append(values, value.Interface())
+			}
+		}
+	}
+
+	switch len(values) {
+	case 0:
+		return "<none>", nil
+	case 1:
+		return values[0], nil
+	default:
+		texts := make([]string, 0, len(values))
+		for _, value := range values {
+			texts = append(texts, fmt.Sprintf("%v", value))
+		}
+
+		return strings.Join(texts, ","), nil
+	}
+}
+
+// addCustomColumns adds the custom columns to the kubectl columns of the item
+func (s *Service) addCustomColumns(item *unstructured.Unstructured, columns []*customColumn) error {
+	values := make(map[string]interface{}, len(columns))
+	for _, column := range columns {
+		value, err := column.evaluate(item)
+		if err != nil {
+			return err
+		}
+		values[column.name] = value
+	}
+
+	return s.addKubectlValues(item, values)
+}
+
+// marshalCustomColumns returns only the custom columns of the items
+func marshalCustomColumns(items []unstructured.Unstructured, columns []*customColumn, isList bool, key string,
+) ([]byte, error) {
+	rows := make([]map[string]interface{}, 0, len(items))
+	for i := range items {
+		kubectlMap, _, _ := unstructured.NestedMap(items[i].UnstructuredContent(), key)
+		row := make(map[string]interface{}, len(columns))
+		for _, column := range columns {
+			row[column.name] = kubectlMap[column.name]
+		}
+		rows = append(rows, row)
+	}
+
+	if !isList && len(rows) == 1 {
+		return json.Marshal(rows[0]) // nolint:wrapcheck // OK
+	}
+
+	return json.Marshal(rows) // nolint:wrapcheck // OK
+}
@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func (s *ServiceTestSuite) TestService_Proxy_KubectlColumns() {
+	tests := []struct {
+		name     string
+		bodyFile string
+		query    url.Values
+		want     map[string]map[string]interface{}
+	}{
+		{
+			name:     "PodList",
+			bodyFile: "/podlist-status/redis.json",
+			query:    url.Values{KubectlColumnsParam: {"Images:.spec.containers[*].image,Phase:status.phase,X:{.missing}"}},
+			want: map[string]map[string]interface{}{
+				"rfr-vcc-0": {"Images": "redis:6.2.6-alpine", "Phase": "Running", "X": "<none>", "Status": "Running"},
+			},
+		},
+		{
+			name:     "Pod",
+			bodyFile: "/pod-status/Running2.json",
+			query:    url.Values{KubectlColumnsParam: {"Containers:.spec.containers[*].name"}},
+			want: map[string]map[string]interface{}{
+				"node-exporter-s6tbv": {"Containers": "node-exporter,kube-rbac-proxy"},
+			},
+		},
+		{
+			name:     "Filtered by custom column",
+			bodyFile: "/podlist-status/redis.json",
+			query: url.Values{
+				KubectlColumnsParam: {"Image:.spec.containers[0].image"}, KubectlSelectorParam: {"Image!=redis:6.2.6-alpine"},
+			},
+			want: map[string]map[string]interface{}{
+				"redisoperator-56d6888cc-ks84t": {"Image": "quay.io/spotahome/redis-operator:latest"},
+			},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			kubectlMaps := s.getKubectlMaps(tc.bodyFile, tc.query)
+
+			for name, want := range tc.want {
+				s.Contains(kubectlMaps, name)
+				for col, value := range want {
+					s.EqualValues(value, kubectlMaps[name][col], name+" "+col)
+				}
+			}
+			if tc.query.Get(KubectlSelectorParam) != "" {
+				s.Len(kubectlMaps, len(tc.want))
+			}
+		})
+	}
+}
+
+func (s *ServiceTestSuite) TestService_Proxy_KubectlOutput() {
+	tests := []struct {
+		name     string
+		bodyFile string
+		query    url.Values
+		want     interface{}
+	}{
+		{
+			name:     "PodList",
+			bodyFile: "/podlist-status/redis.json",
+			query: url.Values{
+				KubectlColumnsParam: {"Name:.metadata.name,Restarts:.status.containerStatuses[0].restartCount"},
+				KubectlOutputParam:  {KubectlOutputColumns},
+				KubectlSortByParam:  {"-Restarts"},
+				KubectlLimitParam:   {"2"},
+			},
+			want: []interface{}{
+				map[string]interface{}{"Name": "redisoperator-56d6888cc-ks84t", "Restarts": float64(1964)},
+				map[string]interface{}{"Name": "rfr-vcc-0", "Restarts": float64(0)},
+			},
+		},
+		{
+			name:     "Pod",
+			bodyFile: "/pod-status/Running.json",
+			query: url.Values{
+				KubectlColumnsParam: {"Name:.metadata.name"}, KubectlOutputParam: {KubectlOutputColumns},
+			},
+			want: map[string]interface{}{"Name": "coredns-8474476ff8-lfwcf"},
+		},
+		{
+			name:     "Empty list",
+			bodyFile: "/podlist-status/no-pod.json",
+			query: url.Values{
+				KubectlColumnsParam: {"Name:.metadata.name"}, KubectlOutputParam: {KubectlOutputColumns},
+			},
+			want: []interface{}{},
+		},
+		{
+			name:     "Not modified kind",
+			bodyFile: "/svclist-status/monitoring.json",
+			query: url.Values{
+				KubectlColumnsParam: {"Name:.metadata.name,Type:.spec.type"}, KubectlOutputParam: {KubectlOutputColumns},
+				KubectlSelectorParam: {"Name=prometheus-stack-grafana"},
+			},
+			want: []interface{}{
+				map[string]interface{}{"Name": "prometheus-stack-grafana", "Type": "ClusterIP"},
+			},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			client := HTTPClient{}
+			resp, err := client.Get(context.Background(), &(url.URL{
+				Scheme: "http", Host: s.service.cfg.ListenAddr, Path: tc.bodyFile, RawQuery: tc.query.Encode(),
+			}))
+			require.NoError(s.T(), err, "Get")
+			require.Equal(s.T(), http.StatusOK, resp.StatusCode, "StatusCode")
+			respBody, err := io.ReadAll(resp.Body)
+			require.NoError(s.T(), err, "ReadAll resp.Body")
+			require.NoError(s.T(), resp.Body.Close(), "Close resp.Body")
+
+			var got interface{}
+			require.NoError(s.T(), json.Unmarshal(respBody, &got), "Unmarshal")
+			s.Equal(tc.want, got)
+		})
+	}
+}
+
+func (s *ServiceTestSuite) TestService_Proxy_KubectlColumns_Invalid() {
+	for _, query := range []url.Values{
+		{KubectlColumnsParam: {"Name"}},
+		{KubectlColumnsParam: {"Name:{.metadata.name"}},
+		{KubectlOutputParam: {KubectlOutputColumns}},
+		{KubectlColumnsParam: {"Name:.metadata.name"}, KubectlOutputParam: {"yaml"}},
+	} {
+		client := HTTPClient{}
+		resp, err := client.Get(context.Background(), &(url.URL{
+			Scheme: "http", Host: s.service.cfg.ListenAddr, Path: "/podlist-status/redis.json", RawQuery: query.Encode(),
+		}))
+		require.NoError(s.T(), err, "Get")
+		resp.Body.Close()
+		s.Equal(http.StatusBadRequest, resp.StatusCode, query.Encode())
+	}
+}
+
+func (s *ServiceTestSuite) TestCustomColumn_Range() {
+	column, err := newCustomColumn("Images", "{range .spec.containers[*]}{.image}{end}")
+	require.NoError(s.T(), err, "newCustomColumn")
+	item := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"containers": []interface{}{
+			map[string]interface{}{"image": "redis"}, map[string]interface{}{"image": "exporter"},
+		}},
+	}}
+	for run := 0; run < 2; run++ {
+		value, err := column.evaluate(item)
+		require.NoError(s.T(), err, "run %d", run)
+		require.Equal(s.T(), "redis,exporter", value, "run %d", run)
+	}
+
+	values := make([]interface{}, 16)
+	wg := sync.WaitGroup{}
+	for i := range values {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			values[i], _ = column.evaluate(item)
+		}(i)
+	}
+	wg.Wait()
+	for i, value := range values {
+		require.Equal(s.T(), "redis,exporter", value, "parallel %d", i)
+	}
+}
@@ -0,0 +1,264 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// decoder creates a decompressing reader
+type decoder func(r io.Reader) (io.ReadCloser, error)
+
+// decoders are the supported Content-Encodings of the upstream responses
+var decoders = map[string]decoder{ // nolint:gochecknoglobals // constant
+	"gzip": func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r) // nolint:wrapcheck // transparent
+	},
+	"deflate": func(r io.Reader) (io.ReadCloser, error) {
+		return flate.NewReader(r), nil
+	},
+	"br": func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(brotli.NewReader(r)), nil
+	},
+	"zstd": func(r io.Reader) (io.ReadCloser, error) {
+		reader, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err // nolint:wrapcheck // transparent
+		}
+
+		return reader.IOReadCloser(), nil
+	},
+}
+
+// contentEncodings returns the Content-Encodings of the response in applied order, without identity.
+// Returns error, if an encoding isn't supported.
+func contentEncodings(header http.Header) ([]string, error) {
+	encodings := []string{}
+	for _, value := range header.Values("Content-Encoding") {
+		for _, encoding := range strings.Split(value, ",") {
+			encoding = strings.ToLower(strings.TrimSpace(encoding))
+			if encoding == "" || encoding == "identity" {
+				continue
+			}
+			if _, has := decoders[encoding]; !has {
+				return encodings, fmt.Errorf("%w: %s", configs.ErrUnsupportedEncoding, encoding)
+			}
+			encodings = append(encodings, encoding)
+		}
+	}
+
+	return encodings, nil
+}
+
+// decodedBody is the decompressed response body, Close closes the decoders and the response body, too
+type decodedBody struct {
+	io.Reader
+	decoders []io.Closer
+	body     io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	for _, decoder := range b.decoders {
+		decoder.Close() // nolint:errcheck,gosec // not important
+	}
+
+	return b.body.Close() // nolint:wrapcheck // transparent
+}
+
+// decodeBody decompresses the response body by the Content-Encoding.
+// The stacked encodings (for example: gzip, br) are decoded in reverse order.
+func decodeBody(resp *http.Response) (io.ReadCloser, error) {
+	encodings, err := contentEncodings(resp.Header)
+	if err != nil {
+		return nil, err
+	}
+	if len(encodings) == 0 {
+		return resp.Body, nil
+	}
+
+	body := &decodedBody{Reader: resp.Body, body: resp.Body}
+	for e := len(encodings) - 1; e >= 0; e-- {
+		reader, err := decoders[encodings[e]](body.Reader)
+		if err != nil {
+			body.Close() // nolint:errcheck,gosec // decoder error is returned
+
+			return nil, fmt.Errorf("resp body %s: %w", encodings[e], err)
+		}
+		body.Reader = reader
+		body.decoders = append(body.decoders, reader)
+	}
+
+	return body, nil
+}
+
+// encoder creates a compressing writer, level 0 is the default compression level
+type encoder func(w io.Writer, level int) (io.WriteCloser, error)
+
+// encoders are the supported Content-Encodings of the responses
+var encoders = map[string]encoder{ // nolint:gochecknoglobals // constant
+	"gzip": func(w io.Writer, level int) (io.WriteCloser, error) {
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+
+		return gzip.NewWriterLevel(w, level) // nolint:wrapcheck // transparent
+	},
+	"deflate": func(w io.Writer, level int) (io.WriteCloser, error) {
+		if level == 0 {
+			level = flate.DefaultCompression
+		}
+
+		return flate.NewWriter(w, level) // nolint:wrapcheck // transparent
+	},
+	"br": func(w io.Writer, level int) (io.WriteCloser, error) {
+		if level <= 0 {
+			level = brotli.DefaultCompression
+		}
+
+		return brotli.NewWriterLevel(w, level), nil
+	},
+	"zstd": func(w io.Writer, level int) (io.WriteCloser, error) {
+		encoderLevel := zstd.SpeedDefault
+		if level > 0 {
+			encoderLevel = zstd.EncoderLevelFromZstd(level)
+		}
+
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(encoderLevel)) // nolint:wrapcheck // transparent
+	},
+}
+
+// validateCompression checks the Compression and the CompressionLevel
+func validateCompression(cfg configs.Proxy) error {
+	for _, encoding := range cfg.Compression {
+		if _, has := encoders[encoding]; !has {
+			return fmt.Errorf("%w: unknown encoding: %s", configs.ErrInvalidCompression, encoding)
+		}
+	}
+	if cfg.CompressionLevel < flate.DefaultCompression || cfg.CompressionLevel > flate.BestCompression {
+		return fmt.Errorf("%w: invalid level: %d", configs.ErrInvalidCompression, cfg.CompressionLevel)
+	}
+
+	return nil
+}
+
+// negotiateEncoding selects the first offered encoding, which is accepted by the Accept-Encoding header.
+// Returns "", if no offered encoding is accepted.
+func negotiateEncoding(acceptEncoding string, offered []string) string {
+	accepted := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				var err error
+				if quality, err = strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err != nil {
+					quality = 0
+				}
+			}
+		}
+		accepted[name] = quality
+	}
+
+	for _, encoding := range offered {
+		quality, has := accepted[encoding]
+		if !has {
+			quality, has = accepted["*"]
+		}
+		if has && quality > 0 {
+			return encoding
+		}
+	}
+
+	return ""
+}
+
+// compressible returns true for the text based content types
+func compressible(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case mediaType == "application/json", mediaType == "application/yaml", mediaType == "application/xml":
+		return true
+	case strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+yaml"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	default:
+		return false
+	}
+}
+
+// compression is the negotiated compression of a response
+type compression struct {
+	encoding string
+	level    int
+	minSize  int
+}
+
+// compressionOf negotiates the compression of the (already decompressed) response with the client.
+// The encoding is empty, if the response shouldn't be compressed.
+func (s *Service) compressionOf(resp *http.Response) compression {
+	if resp.Request == nil || resp.Header.Get("Content-Encoding") != "" ||
+		!compressible(resp.Header.Get("Content-Type")) {
+		return compression{}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return compression{
+		encoding: negotiateEncoding(resp.Request.Header.Get("Accept-Encoding"), s.cfg.Compression),
+		level:    s.cfg.CompressionLevel,
+		minSize:  s.cfg.CompressionMinSize,
+	}
+}
+
+// setCompressionHeaders sets the Content-Encoding and the Vary headers of the compressed response
+func setCompressionHeaders(header http.Header, encoding string) {
+	header.Set("Content-Encoding", encoding)
+	for _, vary := range header.Values("Vary") {
+		for _, name := range strings.Split(vary, ",") {
+			if strings.EqualFold(strings.TrimSpace(name), "Accept-Encoding") {
+				return
+			}
+		}
+	}
+	header.Add("Vary", "Accept-Encoding")
+}
+
+// compressBody compresses the body, if the client accepts it and the body isn't smaller than CompressionMinSize
+func (s *Service) compressBody(resp *http.Response, body []byte) []byte {
+	compression := s.compressionOf(resp)
+	if compression.encoding == "" || len(body) < compression.minSize {
+		return body
+	}
+
+	buf := bytes.Buffer{}
+	writer, err := encoders[compression.encoding](&buf, compression.level)
+	if err == nil {
+		if _, err = writer.Write(body); err == nil {
+			err = writer.Close()
+		}
+	}
+	if err != nil {
+		s.log.Error(err, "Compress", "encoding", compression.encoding)
+
+		return body
+	}
+	setCompressionHeaders(resp.Header, compression.encoding)
+
+	return buf.Bytes()
+}
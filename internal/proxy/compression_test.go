@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+func (s *ServiceTestSuite) TestNegotiateEncoding() {
+	offered := []string{"gzip", "deflate"}
+	tests := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{acceptEncoding: "", want: ""},
+		{acceptEncoding: "gzip", want: "gzip"},
+		{acceptEncoding: "deflate, gzip", want: "gzip"},
+		{acceptEncoding: "deflate", want: "deflate"},
+		{acceptEncoding: "gzip;q=0, deflate;q=0.5", want: "deflate"},
+		{acceptEncoding: "GZIP", want: "gzip"},
+		{acceptEncoding: "*", want: "gzip"},
+		{acceptEncoding: "*, gzip;q=0", want: "deflate"},
+		{acceptEncoding: "br, identity", want: ""},
+		{acceptEncoding: "gzip;q=invalid", want: ""},
+	}
+	for _, tc := range tests {
+		require.Equal(s.T(), tc.want, negotiateEncoding(tc.acceptEncoding, offered), tc.acceptEncoding)
+	}
+	require.Equal(s.T(), "", negotiateEncoding("gzip", nil), "not offered")
+}
+
+func (s *ServiceTestSuite) TestCompressible() {
+	require.True(s.T(), compressible("application/json"), "json")
+	require.True(s.T(), compressible("application/json; charset=utf-8"), "json charset")
+	require.True(s.T(), compressible("text/plain"), "text")
+	require.True(s.T(), compressible("application/merge-patch+json"), "+json")
+	require.False(s.T(), compressible("application/vnd.kubernetes.protobuf"), "protobuf")
+	require.False(s.T(), compressible("image/png"), "png")
+	require.False(s.T(), compressible(""), "empty")
+}
+
+func (s *ServiceTestSuite) TestService_New_InvalidCompression() {
+	cfg := s.service.cfg
+	cfg.Compression = []string{"gzip", "lzw"}
+	_, err := New(cfg, s.service.log)
+	require.ErrorIs(s.T(), err, configs.ErrInvalidCompression, "encoding")
+
+	cfg.Compression = []string{"gzip"}
+	cfg.CompressionLevel = 10
+	_, err = New(cfg, s.service.log)
+	require.ErrorIs(s.T(), err, configs.ErrInvalidCompression, "level")
+	require.ErrorIs(s.T(), s.service.Reload(cfg), configs.ErrInvalidCompression, "Reload")
+}
+
+func (s *ServiceTestSuite) TestService_Proxy_Compression() {
+	tests := []struct {
+		name           string
+		reqPath        string
+		acceptEncoding string
+		minSize        int
+		streamLists    bool
+		compression    []string
+		want           string
+	}{
+		{name: "Gzip", reqPath: "/podlist-status/redis.json", acceptEncoding: "gzip", want: "gzip"},
+		{name: "Deflate", reqPath: "/podlist-status/redis.json", acceptEncoding: "deflate, br", want: "deflate"},
+		{name: "Not accepted", reqPath: "/podlist-status/redis.json", acceptEncoding: "br"},
+		{name: "No Accept-Encoding", reqPath: "/podlist-status/redis.json"},
+		{name: "Small", reqPath: "/pod-status/Running2.json", acceptEncoding: "gzip", minSize: 1024 * 1024},
+		{
+			name: "Streamed", reqPath: "/podlist-status/redis.json", acceptEncoding: "gzip", minSize: 1024 * 1024,
+			streamLists: true, want: "gzip",
+		},
+		{
+			name: "Brotli", reqPath: "/podlist-status/redis.json", acceptEncoding: "gzip, br",
+			compression: []string{"br", "zstd", "gzip"}, want: "br",
+		},
+		{
+			name: "Zstd", reqPath: "/podlist-status/redis.json", acceptEncoding: "gzip, zstd",
+			compression: []string{"br", "zstd", "gzip"}, want: "zstd",
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			cfg := s.service.cfg
+			cfg.Compression = []string{"gzip", "deflate"}
+			if tc.compression != nil {
+				cfg.Compression = tc.compression
+			}
+			cfg.CompressionMinSize = tc.minSize
+			cfg.CompressionLevel = 1
+			cfg.StreamLists = tc.streamLists
+			s.setConfig(cfg)
+
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+				(&url.URL{Scheme: "http", Host: s.service.cfg.ListenAddr, Path: tc.reqPath}).String(), http.NoBody)
+			require.NoError(s.T(), err, "NewRequest")
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(s.T(), err, "Do")
+			require.Equal(s.T(), http.StatusOK, resp.StatusCode, "StatusCode")
+			require.Equal(s.T(), tc.want, resp.Header.Get("Content-Encoding"), "Content-Encoding")
+
+			var reader io.Reader = resp.Body
+			switch tc.want {
+			case "gzip":
+				reader, err = gzip.NewReader(resp.Body)
+				require.NoError(s.T(), err, "gzip")
+				require.Equal(s.T(), "Accept-Encoding", resp.Header.Get("Vary"), "Vary")
+			case "deflate":
+				reader = flate.NewReader(resp.Body)
+			case "br":
+				reader = brotli.NewReader(resp.Body)
+			case "zstd":
+				decoder, err := zstd.NewReader(resp.Body)
+				require.NoError(s.T(), err, "zstd")
+				defer decoder.Close()
+				reader = decoder
+			}
+			body, err := io.ReadAll(reader)
+			require.NoError(s.T(), err, "ReadAll")
+			require.NoError(s.T(), resp.Body.Close(), "Close")
+			require.Contains(s.T(), string(body), `"`+configs.ObjectKeyKubectl+`"`, "Body")
+		})
+	}
+}
+
+func (s *ServiceTestSuite) TestService_ModifyResponse_UnsupportedEncoding() {
+	for _, contentEncoding := range []string{"compress", "gzip, x-custom"} {
+		contentEncoding := contentEncoding
+		s.Run(contentEncoding, func() {
+			body := []byte("not decodable")
+			resp := &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{"Content-Encoding": []string{contentEncoding}, "Content-Length": []string{"13"}},
+				Body:          io.NopCloser(bytes.NewReader(body)),
+				ContentLength: int64(len(body)),
+			}
+			require.NoError(s.T(), s.service.ModifyResponse(resp), "ModifyResponse")
+			require.Equal(s.T(), contentEncoding, resp.Header.Get("Content-Encoding"), "Content-Encoding")
+			require.Equal(s.T(), "13", resp.Header.Get("Content-Length"), "Content-Length")
+			require.Equal(s.T(), EnrichmentSkippedEncoding, resp.Header.Get(EnrichmentHeader), EnrichmentHeader)
+			gotBody, err := io.ReadAll(resp.Body)
+			require.NoError(s.T(), err, "ReadAll")
+			require.Equal(s.T(), body, gotBody, "Body")
+		})
+	}
+}
+
+func (s *ServiceTestSuite) TestContentEncodings() {
+	encodings, err := contentEncodings(http.Header{"Content-Encoding": []string{"GZIP, identity", "br"}})
+	require.NoError(s.T(), err, "stacked")
+	require.Equal(s.T(), []string{"gzip", "br"}, encodings, "stacked")
+
+	_, err = contentEncodings(http.Header{"Content-Encoding": []string{"gzip, compress"}})
+	require.ErrorIs(s.T(), err, configs.ErrUnsupportedEncoding, "unsupported")
+}
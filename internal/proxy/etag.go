@@ -0,0 +1,184 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// CacheControl is the Cache-Control header of the responses with ETag:
+// the response depends on the credentials and must be revalidated before reuse
+const CacheControl = "private, no-cache"
+
+var notModified = promauto.NewCounter(prometheus.CounterOpts{ // nolint:gochecknoglobals // registered once
+	Namespace: metricsNamespace,
+	Name:      "not_modified_total",
+	Help:      "Number of 304 Not Modified responses",
+})
+
+// maxFailedETags is the max number of the remembered ETags of the streamed lists with failed items
+const maxFailedETags = 1024
+
+// etagSeedOf hashes the settings, which change the enrichment of the same resourceVersion
+func etagSeedOf(cfg configs.Proxy) string {
+	type modifierSettings struct {
+		Name  string
+		Scope configs.ModifierScope
+		Order int
+	}
+	modifiers := make([]modifierSettings, 0, len(cfg.Modifiers))
+	for _, modifier := range cfg.Modifiers {
+		modifiers = append(modifiers, modifierSettings{
+			Name: modifier.Name(), Scope: modifier.Scope(), Order: modifier.Order(),
+		})
+	}
+	settings, err := json.Marshal(struct {
+		PodResources     bool
+		PodMetrics       bool
+		PodEvents        bool
+		Kinds            []configs.KindColumns
+		Modifiers        []modifierSettings
+		EnrichmentStrict bool
+	}{
+		PodResources:     cfg.PodResources,
+		PodMetrics:       cfg.PodMetrics,
+		PodEvents:        cfg.PodEvents,
+		Kinds:            cfg.Kinds,
+		Modifiers:        modifiers,
+		EnrichmentStrict: cfg.EnrichmentStrict,
+	})
+	if err != nil {
+		settings = []byte(fmt.Sprintf("%+v", cfg))
+	}
+	hash := fnv.New64a()
+	hash.Write(settings) // nolint:errcheck,gosec // never fails
+
+	return fmt.Sprintf("%x", hash.Sum64())
+}
+
+// etagOf returns the weak ETag of an enriched response, computed from the resourceVersion, the enrichment settings,
+// the own query parameters, the cluster and the time bucket of the Age column (see ETagAgeBucket).
+// Returns "", if ETag is disabled, the response isn't a successful GET or the resourceVersion is unknown.
+// The joined resources (PodMetrics, PodEvents) change without changing the resourceVersion,
+// so there is no ETag, if any of them is enabled.
+func (s *Service) etagOf(resp *http.Response, resourceVersion string) string {
+	if resourceVersion == "" || resp.StatusCode != http.StatusOK || resp.Request == nil ||
+		resp.Request.Method != http.MethodGet {
+		return ""
+	}
+	s.mu.RLock()
+	enabled := s.cfg.ETag && !s.cfg.PodMetrics && !s.cfg.PodEvents
+	bucket := s.cfg.ETagAgeBucket
+	seed := s.etagSeed
+	s.mu.RUnlock()
+	if !enabled {
+		return ""
+	}
+
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%s/%s/%s", seed, s.upstreamOf(resp.Request).name, getRequestOptions(resp.Request).raw)
+	if bucket > 0 {
+		fmt.Fprintf(hash, "/%d", time.Now().Truncate(bucket).UnixNano())
+	}
+
+	return fmt.Sprintf(`W/"%s-%x"`, resourceVersion, hash.Sum64())
+}
+
+// bodyResourceVersion returns the metadata.resourceVersion of a JSON body, "" if it's unknown
+func bodyResourceVersion(body []byte) string {
+	object := struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+	}{}
+	if err := json.Unmarshal(body, &object); err != nil {
+		return ""
+	}
+
+	return object.Metadata.ResourceVersion
+}
+
+// matchesETag returns true, if the If-None-Match header matches the ETag (weak comparison)
+func matchesETag(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// failedETags are the ETags of the streamed lists with failed items. The ETag of a streamed list is sent before
+// its items, so these ETags aren't answered by 304 Not Modified. The oldest ones are dropped above maxFailedETags.
+type failedETags struct {
+	mu    sync.Mutex
+	etags map[string]struct{}
+	order []string
+}
+
+func newFailedETags() *failedETags {
+	return &failedETags{etags: map[string]struct{}{}}
+}
+
+// add remembers the ETag of a list with failed items
+func (f *failedETags) add(etag string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, has := f.etags[etag]; has {
+		return
+	}
+	if len(f.order) >= maxFailedETags {
+		delete(f.etags, f.order[0])
+		f.order = f.order[1:]
+	}
+	f.etags[etag] = struct{}{}
+	f.order = append(f.order, etag)
+}
+
+// has returns true, if the ETag belongs to a list with failed items
+func (f *failedETags) has(etag string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, has := f.etags[etag]
+
+	return has
+}
+
+// conditionalResponse sets the ETag and the Cache-Control headers and replaces the response by 304 Not Modified,
+// if the If-None-Match header of the client matches. Returns true, if the response is replaced.
+// The responses with failed items mustn't get ETag (the caller checks it), see failedETags.
+// The original body is closed by the caller.
+func (s *Service) conditionalResponse(resp *http.Response, resourceVersion string) bool {
+	etag := s.etagOf(resp, resourceVersion)
+	if etag == "" {
+		return false
+	}
+	resp.Header.Set("ETag", etag)
+	resp.Header.Set("Cache-Control", CacheControl)
+	ifNoneMatch := resp.Request.Header.Get("If-None-Match")
+	if ifNoneMatch == "" || !matchesETag(ifNoneMatch, etag) || s.failedETags.has(etag) {
+		return false
+	}
+
+	notModified.Inc()
+	resp.StatusCode = http.StatusNotModified
+	resp.Status = fmt.Sprintf("%d %s", http.StatusNotModified, http.StatusText(http.StatusNotModified))
+	resp.Body = http.NoBody
+	resp.ContentLength = 0
+	for _, header := range []string{"Content-Length", "Content-Encoding", "Content-Type"} {
+		resp.Header.Del(header)
+	}
+
+	return true
+}
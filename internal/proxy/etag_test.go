@@ -0,0 +1,228 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+func (s *ServiceTestSuite) TestMatchesETag() {
+	etag := `W/"100-abc"`
+	require.True(s.T(), matchesETag(`W/"100-abc"`, etag), "same")
+	require.True(s.T(), matchesETag(`"100-abc"`, etag), "weak comparison")
+	require.True(s.T(), matchesETag(`"other", W/"100-abc"`, etag), "list")
+	require.True(s.T(), matchesETag("*", etag), "any")
+	require.False(s.T(), matchesETag(`W/"101-abc"`, etag), "other")
+}
+
+// apiServerPodList returns a Pod list file in the field order of the API server (metadata before items)
+func apiServerPodList(s *ServiceTestSuite, file string, resourceVersion string) []byte {
+	s.T().Helper()
+	body, err := os.ReadFile(file)
+	require.NoError(s.T(), err, "ReadFile")
+	list := struct {
+		Items json.RawMessage `json:"items"`
+	}{}
+	require.NoError(s.T(), json.Unmarshal(body, &list), "Unmarshal")
+
+	return []byte(`{"kind":"PodList","apiVersion":"v1","metadata":{"resourceVersion":"` + resourceVersion + `"},` +
+		`"items":` + string(list.Items) + `}`)
+}
+
+func (s *ServiceTestSuite) TestService_ModifyResponse_ETag() {
+	body := apiServerPodList(s, "../../test/podlist-status/redis.json", "100")
+
+	for _, streamLists := range []bool{false, true} {
+		cfg := s.service.cfg
+		cfg.ETag = true
+		cfg.StreamLists = streamLists
+		s.setConfig(cfg)
+
+		modify := func(ifNoneMatch string) *http.Response {
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+				"http://127.0.0.1:8001/", http.NoBody)
+			require.NoError(s.T(), err, "NewRequest")
+			if ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", ifNoneMatch)
+			}
+			resp := newListResponse(req, body, "")
+			require.NoError(s.T(), s.service.ModifyResponse(resp), "ModifyResponse")
+
+			return resp
+		}
+
+		resp := modify("")
+		etag := resp.Header.Get("ETag")
+		require.Regexp(s.T(), `^W/"100-[0-9a-f]+"$`, etag, "ETag")
+		require.Equal(s.T(), CacheControl, resp.Header.Get("Cache-Control"), "Cache-Control")
+		require.Equal(s.T(), http.StatusOK, resp.StatusCode, "StatusCode")
+		gotBody, err := io.ReadAll(resp.Body)
+		require.NoError(s.T(), err, "ReadAll")
+		require.NotEmpty(s.T(), gotBody, "Body")
+
+		resp = modify(etag)
+		require.Equal(s.T(), http.StatusNotModified, resp.StatusCode, "If-None-Match")
+		require.Equal(s.T(), etag, resp.Header.Get("ETag"), "ETag of 304")
+		require.Empty(s.T(), resp.Header.Get("Content-Length"), "Content-Length of 304")
+		gotBody, err = io.ReadAll(resp.Body)
+		require.NoError(s.T(), err, "ReadAll 304")
+		require.Empty(s.T(), gotBody, "Body of 304")
+
+		require.Equal(s.T(), http.StatusOK, modify(`W/"99-0"`).StatusCode, "changed")
+
+		cfg.PodResources = !cfg.PodResources
+		s.setConfig(cfg)
+		resp = modify(etag)
+		require.Equal(s.T(), http.StatusOK, resp.StatusCode, "other settings")
+		require.NotEqual(s.T(), etag, resp.Header.Get("ETag"), "ETag of other settings")
+
+		cfg.ETag = false
+		s.setConfig(cfg)
+		resp = modify(etag)
+		require.Equal(s.T(), http.StatusOK, resp.StatusCode, "disabled")
+		require.Empty(s.T(), resp.Header.Get("ETag"), "ETag disabled")
+	}
+}
+
+func (s *ServiceTestSuite) TestService_ETagAgeBucket() {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://127.0.0.1:8001/", http.NoBody)
+	require.NoError(s.T(), err, "NewRequest")
+	resp := &http.Response{StatusCode: http.StatusOK, Request: req}
+
+	cfg := s.service.cfg
+	cfg.ETag = true
+	cfg.ETagAgeBucket = time.Hour
+	s.setConfig(cfg)
+	etag := s.service.etagOf(resp, "100")
+	require.Equal(s.T(), etag, s.service.etagOf(resp, "100"), "same bucket")
+
+	cfg.ETagAgeBucket = time.Nanosecond
+	s.setConfig(cfg)
+	etag = s.service.etagOf(resp, "100")
+	time.Sleep(time.Millisecond)
+	require.NotEqual(s.T(), etag, s.service.etagOf(resp, "100"), "next bucket")
+
+	require.Empty(s.T(), s.service.etagOf(resp, ""), "no resourceVersion")
+}
+
+func (s *ServiceTestSuite) TestService_ModifyResponse_ETagFailures() {
+	list := struct {
+		Items json.RawMessage `json:"items"`
+	}{}
+	require.NoError(s.T(), json.Unmarshal([]byte(brokenPodList(s)), &list), "Unmarshal")
+	body := []byte(`{"kind":"PodList","apiVersion":"v1","metadata":{"resourceVersion":"100"},"items":` +
+		string(list.Items) + `}`)
+
+	for _, streamLists := range []bool{false, true} {
+		cfg := s.service.cfg
+		cfg.ETag = true
+		cfg.StreamLists = streamLists
+		s.setConfig(cfg)
+
+		modify := func(ifNoneMatch string) (*http.Response, []byte) {
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+				"http://127.0.0.1:8001/", http.NoBody)
+			require.NoError(s.T(), err, "NewRequest")
+			if ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", ifNoneMatch)
+			}
+			resp := newListResponse(req, body, "")
+			require.NoError(s.T(), s.service.ModifyResponse(resp), "ModifyResponse")
+			gotBody, err := io.ReadAll(resp.Body)
+			require.NoError(s.T(), err, "ReadAll")
+
+			return resp, gotBody
+		}
+
+		resp, gotBody := modify("")
+		require.Contains(s.T(), string(gotBody), ErrorColumn, "annotated")
+		etag := resp.Header.Get("ETag")
+		if !streamLists {
+			require.Empty(s.T(), etag, "no ETag with failed items")
+
+			continue
+		}
+		// The ETag of a streamed list is sent before the failed item
+		require.NotEmpty(s.T(), etag, "ETag of the streamed list")
+		resp, gotBody = modify(etag)
+		require.Equal(s.T(), http.StatusOK, resp.StatusCode, "no 304 for failed items")
+		require.NotEmpty(s.T(), gotBody, "Body")
+	}
+}
+
+func (s *ServiceTestSuite) TestService_ETagOf_Settings() {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://127.0.0.1:8001/", http.NoBody)
+	require.NoError(s.T(), err, "NewRequest")
+	resp := &http.Response{StatusCode: http.StatusOK, Request: req}
+
+	cfg := s.service.cfg
+	cfg.ETag = true
+	s.setConfig(cfg)
+	etag := s.service.etagOf(resp, "100")
+	require.NotEmpty(s.T(), etag, "ETag")
+
+	optsReq, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+		"http://127.0.0.1:8001/?"+KubectlLimitParam+"=1", http.NoBody)
+	require.NoError(s.T(), err, "NewRequest")
+	optsReq, err = parseRequestOptions(optsReq)
+	require.NoError(s.T(), err, "parseRequestOptions")
+	require.NotEqual(s.T(), etag, s.service.etagOf(&http.Response{StatusCode: http.StatusOK, Request: optsReq}, "100"),
+		"request options")
+
+	settings := []func(cfg *configs.Proxy){
+		func(cfg *configs.Proxy) { cfg.EnrichmentStrict = true },
+		func(cfg *configs.Proxy) {
+			cfg.Modifiers = []configs.Modifier{&traceModifier{name: "trace", scope: configs.ScopeAll}}
+		},
+	}
+	for i, setting := range settings {
+		changed := cfg
+		setting(&changed)
+		s.setConfig(changed)
+		require.NotEqual(s.T(), etag, s.service.etagOf(resp, "100"), "setting %d", i)
+	}
+
+	for _, join := range []func(cfg *configs.Proxy){
+		func(cfg *configs.Proxy) { cfg.PodMetrics = true },
+		func(cfg *configs.Proxy) { cfg.PodEvents = true },
+	} {
+		changed := cfg
+		join(&changed)
+		s.setConfig(changed)
+		require.Empty(s.T(), s.service.etagOf(resp, "100"), "no ETag with joins")
+	}
+}
+
+func (s *ServiceTestSuite) TestService_ModifyResponse_ETagStreamedObject() {
+	body, err := os.ReadFile("../../test/pod-status/Running2.json")
+	require.NoError(s.T(), err, "ReadFile")
+	cfg := s.service.cfg
+	cfg.ETag = true
+	cfg.StreamLists = true
+	s.setConfig(cfg)
+
+	modify := func(ifNoneMatch string) *http.Response {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://127.0.0.1:8001/", http.NoBody)
+		require.NoError(s.T(), err, "NewRequest")
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		resp := newListResponse(req, body, "")
+		require.NoError(s.T(), s.service.ModifyResponse(resp), "ModifyResponse")
+
+		return resp
+	}
+
+	resp := modify("")
+	require.Equal(s.T(), http.StatusOK, resp.StatusCode, "StatusCode")
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(s.T(), etag, "ETag after enrichment")
+	require.Equal(s.T(), http.StatusNotModified, modify(etag).StatusCode, "If-None-Match")
+}
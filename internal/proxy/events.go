@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// podEvent is a summary of an Event, like a row of the Events in `kubectl describe pod`
+type podEvent struct {
+	Type     string
+	Reason   string
+	Message  string
+	Count    int64
+	LastSeen time.Time
+}
+
+func (e *podEvent) toValue() map[string]interface{} {
+	lastSeen := "<unknown>"
+	if !e.LastSeen.IsZero() {
+		lastSeen = e.LastSeen.UTC().Format(time.RFC3339)
+	}
+
+	return map[string]interface{}{
+		"Type":     e.Type,
+		"Reason":   e.Reason,
+		"Message":  e.Message,
+		"Count":    e.Count,
+		"LastSeen": lastSeen,
+	}
+}
+
+// joinPodEvents adds the Events of the Pods.
+// A single Pod gets all of its core/v1 and events.k8s.io Events, deduplicated and sorted by the last seen.
+// Pods of a list get only the most recent Warning, in order to keep the payload small.
+func (s *Service) joinPodEvents(ctx context.Context, req *http.Request, items []*unstructured.Unstructured, isList bool) {
+	var events map[string][]*podEvent
+	if isList {
+		events = s.getPodWarnings(ctx, req, commonNamespace(items))
+	} else {
+		events = s.getPodEvents(ctx, req, items[0])
+	}
+
+	for _, item := range items {
+		s.setPodEvents(item, events)
+	}
+}
+
+// setPodEvents adds the Events column to a Pod, by the result of getPodEvents or getPodWarnings
+func (s *Service) setPodEvents(item *unstructured.Unstructured, events map[string][]*podEvent) {
+	values := []interface{}{}
+	for _, event := range events[item.GetNamespace()+"/"+item.GetName()] {
+		values = append(values, event.toValue())
+	}
+	if err := s.addKubectlValues(item, map[string]interface{}{FormatKubectlColumn("Events"): values}); err != nil {
+		s.log.Error(err, "PodEvents")
+	}
+}
+
+func (s *Service) getPodEvents(ctx context.Context, req *http.Request, item *unstructured.Unstructured,
+) map[string][]*podEvent {
+	namespace := item.GetNamespace()
+	key := namespace + "/" + item.GetName()
+	merged := map[string]*podEvent{}
+
+	coreQuery := url.Values{"fieldSelector": []string{fmt.Sprintf(
+		"involvedObject.kind=Pod,involvedObject.namespace=%s,involvedObject.name=%s", namespace, item.GetName(),
+	)}}
+	coreEvents, err := s.getEvents(ctx, req, "/api/v1/namespaces/"+namespace+"/events", coreQuery, "involvedObject")
+	if err != nil {
+		s.log.Error(err, "PodEvents")
+	}
+	eventsQuery := url.Values{"fieldSelector": []string{fmt.Sprintf(
+		"regarding.kind=Pod,regarding.namespace=%s,regarding.name=%s", namespace, item.GetName(),
+	)}}
+	eventsEvents, err := s.getEvents(ctx, req,
+		"/apis/events.k8s.io/v1/namespaces/"+namespace+"/events", eventsQuery, "regarding")
+	if err != nil {
+		s.log.Error(err, "PodEvents")
+	}
+
+	for _, event := range append(coreEvents[key], eventsEvents[key]...) {
+		dedupKey := event.Type + "/" + event.Reason + "/" + event.Message
+		if prev, has := merged[dedupKey]; has {
+			if event.Count > prev.Count {
+				prev.Count = event.Count
+			}
+			if event.LastSeen.After(prev.LastSeen) {
+				prev.LastSeen = event.LastSeen
+			}
+		} else {
+			merged[dedupKey] = event
+		}
+	}
+
+	events := make([]*podEvent, 0, len(merged))
+	for _, event := range merged {
+		events = append(events, event)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].LastSeen.Equal(events[j].LastSeen) {
+			return events[i].Reason < events[j].Reason
+		}
+
+		return events[i].LastSeen.Before(events[j].LastSeen)
+	})
+
+	return map[string][]*podEvent{key: events}
+}
+
+// getPodWarnings returns the most recent Warning of the Pods, in the namespace or in all namespaces
+func (s *Service) getPodWarnings(ctx context.Context, req *http.Request, namespace string,
+) map[string][]*podEvent {
+	eventsPath := "/api/v1/events"
+	if namespace != "" {
+		eventsPath = "/api/v1/namespaces/" + namespace + "/events"
+	}
+
+	query := url.Values{"fieldSelector": []string{"involvedObject.kind=Pod,type=Warning"}}
+	warnings, err := s.getEvents(ctx, req, eventsPath, query, "involvedObject")
+	if err != nil {
+		s.log.Error(err, "PodEvents")
+
+		return nil
+	}
+
+	lastWarnings := map[string][]*podEvent{}
+	for key, events := range warnings {
+		var last *podEvent
+		for _, event := range events {
+			if event.Type == "Warning" && (last == nil || event.LastSeen.After(last.LastSeen)) {
+				last = event
+			}
+		}
+		if last != nil {
+			lastWarnings[key] = []*podEvent{last}
+		}
+	}
+
+	return lastWarnings
+}
+
+// getEvents gets core/v1 or events.k8s.io Events, by namespace/name of the regarding Pod.
+// The field selector is double-checked, because it's not evaluated by every upstream.
+func (s *Service) getEvents(ctx context.Context, req *http.Request, eventsPath string, query url.Values,
+	objectKey string,
+) (map[string][]*podEvent, error) {
+	body, err := s.getUpstream(ctx, req, eventsPath, query)
+	if err != nil {
+		return nil, err
+	}
+	eventList := &unstructured.UnstructuredList{}
+	if err := eventList.UnmarshalJSON(body); err != nil {
+		return nil, fmt.Errorf("unmarshaljson events: %w", err)
+	}
+
+	events := map[string][]*podEvent{}
+	for i := range eventList.Items {
+		content := eventList.Items[i].UnstructuredContent()
+		object, _, _ := unstructured.NestedStringMap(content, objectKey)
+		if object["kind"] != "Pod" {
+			continue
+		}
+		key := object["namespace"] + "/" + object["name"]
+		events[key] = append(events[key], newPodEvent(content))
+	}
+
+	return events, nil
+}
+
+// newPodEvent parses both core/v1 and events.k8s.io Event
+func newPodEvent(content map[string]interface{}) *podEvent {
+	event := &podEvent{}
+	event.Type, _, _ = unstructured.NestedString(content, "type")
+	event.Reason, _, _ = unstructured.NestedString(content, "reason")
+	if event.Message, _, _ = unstructured.NestedString(content, "message"); event.Message == "" {
+		event.Message, _, _ = unstructured.NestedString(content, "note")
+	}
+
+	for _, path := range [][]string{{"count"}, {"series", "count"}, {"deprecatedCount"}} {
+		if count, has, _ := unstructured.NestedInt64(content, path...); has && count > event.Count {
+			event.Count = count
+		}
+	}
+	if event.Count == 0 {
+		event.Count = 1
+	}
+
+	for _, path := range [][]string{
+		{"lastTimestamp"}, {"series", "lastObservedTime"}, {"deprecatedLastTimestamp"},
+		{"eventTime"}, {"firstTimestamp"}, {"deprecatedFirstTimestamp"},
+	} {
+		if timestamp, has, _ := unstructured.NestedString(content, path...); has && timestamp != "" {
+			if lastSeen, err := time.Parse(time.RFC3339, timestamp); err == nil && lastSeen.After(event.LastSeen) {
+				event.LastSeen = lastSeen
+			}
+		}
+	}
+
+	return event
+}
@@ -0,0 +1,69 @@
+package proxy
+
+func (s *ServiceTestSuite) TestService_Proxy_PodEvents() {
+	s.service.cfg.PodEvents = true
+	backOff := `Back-off pulling image "registry.example.com/tester:latest"`
+	failed := `Failed to pull image "registry.example.com/tester:latest": ` +
+		`rpc error: code = Unknown desc = Requesting bear token: invalid status code from registry 403 (Forbidden)`
+	tests := []struct {
+		name     string
+		bodyFile string
+		want     map[string][]interface{}
+	}{
+		{
+			name:     "Pod",
+			bodyFile: "/pod-status/ErrImagePull.json",
+			want: map[string][]interface{}{
+				"tester": {
+					map[string]interface{}{
+						"Type": "Normal", "Reason": "Scheduled", "Count": int64(1), "LastSeen": "2022-06-01T10:00:00Z",
+						"Message": "Successfully assigned salesforce-latest/tester to hu2-vmp9",
+					},
+					map[string]interface{}{
+						"Type": "Normal", "Reason": "Pulling", "Count": int64(5), "LastSeen": "2022-06-01T10:04:10Z",
+						"Message": `Pulling image "registry.example.com/tester:latest"`,
+					},
+					map[string]interface{}{
+						"Type": "Warning", "Reason": "Failed", "Count": int64(5), "LastSeen": "2022-06-01T10:04:11Z",
+						"Message": failed,
+					},
+					map[string]interface{}{
+						"Type": "Warning", "Reason": "BackOff", "Count": int64(21), "LastSeen": "2022-06-01T10:05:30Z",
+						"Message": backOff,
+					},
+				},
+			},
+		},
+		{
+			name:     "PodList",
+			bodyFile: "/podlist-status/redis.json",
+			want: map[string][]interface{}{
+				"redisoperator-56d6888cc-ks84t": {
+					map[string]interface{}{
+						"Type": "Warning", "Reason": "BackOff", "Count": int64(1964), "LastSeen": "2022-06-01T10:01:00Z",
+						"Message": "Back-off restarting failed container",
+					},
+				},
+				"rfr-vcc-0": {},
+			},
+		},
+		{
+			name:     "No Events",
+			bodyFile: "/pod-status/Running.json",
+			want: map[string][]interface{}{
+				"coredns-8474476ff8-lfwcf": {},
+			},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			kubectlMaps := s.getKubectlMaps(tc.bodyFile, nil)
+
+			for name, want := range tc.want {
+				s.Contains(kubectlMaps, name)
+				s.EqualValues(want, kubectlMaps[name]["Events"], name)
+			}
+		})
+	}
+}
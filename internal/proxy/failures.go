@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ErrorColumn is the enrichment error, added to the kubectl columns of the failed items of a list
+const ErrorColumn = "Error"
+
+var enrichmentItemErrors = promauto.NewCounter(prometheus.CounterOpts{ // nolint:gochecknoglobals // registered once
+	Namespace: metricsNamespace,
+	Name:      "enrichment_item_errors_total",
+	Help:      "Number of the list items, which failed the enrichment",
+})
+
+// enrichFailures summarises the items of a list, which failed the enrichment
+type enrichFailures struct {
+	failed int
+	// first is the error of the first failed item, prefixed by the item
+	first error
+}
+
+// merge adds the failures of another list (page, cluster), both can be nil
+func (f *enrichFailures) merge(other *enrichFailures) *enrichFailures {
+	if other == nil {
+		return f
+	}
+	if f == nil {
+		return &enrichFailures{failed: other.failed, first: other.first}
+	}
+	f.failed += other.failed
+
+	return f
+}
+
+// warning returns the text of the Warning header
+func (f *enrichFailures) warning() string {
+	return fmt.Sprintf("enrichment failed on %d item(s), first: %s", f.failed, f.first)
+}
+
+// itemFailures annotates the failed items and summarises them, returns nil, if no item failed
+func (s *Service) itemFailures(items []*unstructured.Unstructured, errs []error, cluster string) *enrichFailures {
+	var failures *enrichFailures
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if failures == nil {
+			failures = &enrichFailures{first: fmt.Errorf("%s: %w", itemRef(items[i]), err)}
+		}
+		failures.failed++
+		s.annotateItemError(items[i], err, cluster)
+	}
+	if failures != nil {
+		enrichmentItemErrors.Add(float64(failures.failed))
+		s.log.Error(failures.first, "Enrichment", "failed", failures.failed, "items", len(items))
+	}
+
+	return failures
+}
+
+// annotateItemError adds the error (and the cluster) to the kubectl columns of a failed item
+func (s *Service) annotateItemError(item *unstructured.Unstructured, err error, cluster string) {
+	values := map[string]interface{}{ErrorColumn: err.Error()}
+	if cluster != "" {
+		values[ClusterColumn] = cluster
+	}
+	if err := s.addKubectlValues(item, values); err != nil {
+		s.log.Error(err, "Enrichment", "item", itemRef(item))
+	}
+}
+
+// itemRef returns the namespace/name of an item
+func itemRef(item *unstructured.Unstructured) string {
+	if item.GetNamespace() == "" {
+		return item.GetName()
+	}
+
+	return item.GetNamespace() + "/" + item.GetName()
+}
+
+// warnFailures marks the partially enriched response by the EnrichmentHeader
+// and adds the Warning of the failures, if EnrichmentWarnings is enabled
+func (s *Service) warnFailures(header http.Header, failures *enrichFailures) {
+	if failures == nil {
+		return
+	}
+	header.Set(EnrichmentHeader, EnrichmentPartial)
+	s.mu.RLock()
+	warnings := s.cfg.EnrichmentWarnings
+	s.mu.RUnlock()
+	if warnings {
+		addWarning(header, failures.warning())
+	}
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// brokenPodList returns a Pod list, the spec of the first Pod is invalid
+func brokenPodList(s *ServiceTestSuite) string {
+	s.T().Helper()
+	body, err := os.ReadFile("../../test/podlist-status/redis.json")
+	require.NoError(s.T(), err, "ReadFile")
+	podList := map[string]interface{}{}
+	require.NoError(s.T(), json.Unmarshal(body, &podList), "Unmarshal")
+	podList["kind"] = "PodList"
+	items, is := podList["items"].([]interface{})
+	require.True(s.T(), is, "items")
+	require.Greater(s.T(), len(items), 1, "items")
+	pod, is := items[0].(map[string]interface{})
+	require.True(s.T(), is, "pod")
+	require.NoError(s.T(), unstructured.SetNestedField(pod, "invalid", "spec", "containers"), "SetNestedField")
+	body, err = json.Marshal(podList)
+	require.NoError(s.T(), err, "Marshal")
+
+	return string(body)
+}
+
+func (s *ServiceTestSuite) TestService_EnrichmentFailures() {
+	body := brokenPodList(s)
+	tests := []struct {
+		name        string
+		streamLists bool
+		strict      bool
+	}{
+		{name: "Buffered", streamLists: false},
+		{name: "Streamed", streamLists: true},
+		{name: "Strict", streamLists: true, strict: true},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			cfg := s.service.cfg
+			cfg.StreamLists = tc.streamLists
+			cfg.EnrichmentStrict = tc.strict
+			cfg.EnrichmentWarnings = true
+			cfg.ProxyTransport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				return newTestResponse(r, http.StatusOK, body), nil
+			})
+			s.setConfig(cfg)
+
+			gotBody, resp := s.getBody("/api/v1/namespaces/redis/pods", nil)
+			if tc.strict {
+				require.Equal(s.T(), body, string(gotBody), "untouched")
+				require.Equal(s.T(), EnrichmentFailed, resp.Header.Get(EnrichmentHeader), EnrichmentHeader)
+
+				return
+			}
+			if !tc.streamLists {
+				require.Equal(s.T(), EnrichmentPartial, resp.Header.Get(EnrichmentHeader), EnrichmentHeader)
+				require.Regexp(s.T(), `^299 - "enrichment failed on 1 item\(s\), first: redis/.+"$`,
+					resp.Header.Get("Warning"), "Warning")
+			}
+			gotList := &unstructured.UnstructuredList{}
+			require.NoError(s.T(), gotList.UnmarshalJSON(gotBody), "UnmarshalJSON")
+			for i, item := range gotList.Items {
+				kubectlMap, _, err := unstructured.NestedMap(item.Object, configs.ObjectKeyKubectl)
+				require.NoError(s.T(), err, "item %d", i)
+				if i == 0 {
+					require.NotEmpty(s.T(), kubectlMap[ErrorColumn], "failed item")
+				} else {
+					require.NotContains(s.T(), kubectlMap, ErrorColumn, "item %d", i)
+					require.NotEmpty(s.T(), kubectlMap["Status"], "item %d", i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// KubectlSelectorParam is the query parameter for filtering list items by the kubectl columns, for example:
+// curl '127.0.0.1:8003/api/v1/pods?kubectlSelector=Status!=Running,Restarts>5'
+const KubectlSelectorParam = "kubectlSelector"
+
+// kubectlOperators are ordered by length, so the longest one wins at the same position (for example: >= before >)
+var kubectlOperators = []string{"==", "!=", ">=", "<=", "=", ">", "<"} // nolint:gochecknoglobals // constant
+
+// kubectlRequirement is an expression of a kubectl column, for example: Restarts>5
+type kubectlRequirement struct {
+	column   string
+	operator string
+	value    string
+}
+
+// kubectlSelector is a list of requirements, all of them must be matched
+type kubectlSelector []kubectlRequirement
+
+func parseKubectlSelector(text string) (kubectlSelector, error) {
+	selector := kubectlSelector{}
+	for _, expression := range strings.Split(text, ",") {
+		expression = strings.TrimSpace(expression)
+		if expression == "" {
+			continue
+		}
+		// The expression is split at the leftmost operator, so the value can contain operators
+		requirement := kubectlRequirement{}
+		opPos := -1
+		for _, operator := range kubectlOperators {
+			if pos := strings.Index(expression, operator); pos >= 0 && (opPos < 0 || pos < opPos) {
+				opPos = pos
+				requirement = kubectlRequirement{
+					column:   strings.TrimSpace(expression[:pos]),
+					operator: operator,
+					value:    strings.TrimSpace(expression[pos+len(operator):]),
+				}
+			}
+		}
+		if requirement.operator == "" || requirement.column == "" {
+			return nil, fmt.Errorf("%w: %s", configs.ErrInvalidKubectlSelector, expression)
+		}
+		if requirement.operator == "==" {
+			requirement.operator = "="
+		}
+		selector = append(selector, requirement)
+	}
+
+	return selector, nil
+}
+
+// Matches checks the kubectl columns (under the key) of an already modified item
+func (sel kubectlSelector) Matches(item *unstructured.Unstructured, key string) bool {
+	kubectlMap, _, _ := unstructured.NestedMap(item.UnstructuredContent(), key)
+	for _, requirement := range sel {
+		if !requirement.matches(kubectlMap[requirement.column]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filterItems keeps the matching items of a list
+func filterItems(items []unstructured.Unstructured, selector kubectlSelector, key string,
+) []unstructured.Unstructured {
+	filtered := make([]unstructured.Unstructured, 0, len(items))
+	for i := range items {
+		if selector.Matches(&items[i], key) {
+			filtered = append(filtered, items[i])
+		}
+	}
+
+	return filtered
+}
+
+func (req kubectlRequirement) matches(actual interface{}) bool {
+	cmp, comparable := compareKubectlValues(actual, req.value)
+	if !comparable {
+		return req.operator == "!="
+	}
+
+	switch req.operator {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+
+	return false
+}
+
+// compareKubectlValues compares a kubectl column value to the value of the expression.
+// Numbers (Restarts), ratios (Ready, for example: Ready<1) and kubectl durations (Age) are compared by value,
+// other values are compared as text. A missing column is not comparable.
+func compareKubectlValues(actual interface{}, value string) (int, bool) {
+	if actual == nil {
+		return 0, false
+	}
+	text := fmt.Sprintf("%v", actual)
+
+	if a, ok := parseKubectlNumber(text); ok {
+		if b, ok := parseKubectlNumber(value); ok {
+			return compareFloats(a, b), true
+		}
+	}
+	if a, ok := parseKubectlDuration(text); ok {
+		if b, ok := parseKubectlDuration(value); ok {
+			return compareFloats(float64(a), float64(b)), true
+		}
+	}
+
+	return strings.Compare(text, value), true
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// kubectlNumberRe matches numbers, ratios (1/2) and restarts with last restart (3 (5m ago))
+var kubectlNumberRe = regexp.MustCompile(`^(\d+(?:\.\d+)?)(?:/(\d+))?(?: \(.*\))?$`) // nolint:gochecknoglobals,lll // constant
+
+func parseKubectlNumber(text string) (float64, bool) {
+	matches := kubectlNumberRe.FindStringSubmatch(text)
+	if matches == nil {
+		return 0, false
+	}
+	number, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	if matches[2] != "" {
+		total, err := strconv.ParseFloat(matches[2], 64)
+		if err != nil {
+			return 0, false
+		}
+		if total == 0 {
+			return 1, true
+		}
+		number /= total
+	}
+
+	return number, true
+}
+
+// kubectlDurationRe matches the human readable durations of kubectl, for example: 3y45d, 2d3h, 5m10s
+var kubectlDurationRe = regexp.MustCompile(`^(?:(\d+)y)?(?:(\d+)d)?(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s)?$`) // nolint:gochecknoglobals,lll // constant
+
+var kubectlDurationUnits = []time.Duration{ // nolint:gochecknoglobals // constant
+	365 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second,
+}
+
+func parseKubectlDuration(text string) (time.Duration, bool) {
+	matches := kubectlDurationRe.FindStringSubmatch(text)
+	if text == "" || matches == nil {
+		return 0, false
+	}
+	var duration time.Duration
+	for u, unit := range kubectlDurationUnits {
+		if matches[u+1] == "" {
+			continue
+		}
+		value, err := strconv.ParseInt(matches[u+1], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		duration += time.Duration(value) * unit
+	}
+
+	return duration, true
+}
@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+func (s *ServiceTestSuite) TestService_Proxy_KubectlSelector() {
+	tests := []struct {
+		name     string
+		selector string
+		want     []string
+	}{
+		{
+			name:     "Status",
+			selector: "Status!=Running",
+			want:     []string{"redisoperator-56d6888cc-ks84t"},
+		},
+		{
+			name:     "Restarts",
+			selector: "Restarts>5",
+			want:     []string{"redisoperator-56d6888cc-ks84t"},
+		},
+		{
+			name:     "Ready mismatch",
+			selector: "Ready<1",
+			want:     []string{"redisoperator-56d6888cc-ks84t"},
+		},
+		{
+			name:     "Multiple",
+			selector: "Status==Running, Node=o-k8s-vps3",
+			want:     []string{"rfr-vcc-1", "rfs-vcc-5cc6bf796c-mmrkr"},
+		},
+		{
+			name:     "Age",
+			selector: "Age>=1y",
+			want: []string{
+				"redisoperator-56d6888cc-ks84t", "rfr-vcc-0", "rfr-vcc-1",
+				"rfs-vcc-5cc6bf796c-g9mnr", "rfs-vcc-5cc6bf796c-mmrkr",
+			},
+		},
+		{
+			name:     "Missing column",
+			selector: "Missing=x",
+			want:     []string{},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			kubectlMaps := s.getKubectlMaps("/podlist-status/redis.json", url.Values{KubectlSelectorParam: {tc.selector}})
+			names := []string{}
+			for name := range kubectlMaps {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			s.Equal(tc.want, names)
+
+			transport, is := s.service.cfg.ProxyTransport.(*TestTransport)
+			require.True(s.T(), is, "TestTransport")
+			s.NotContains(transport.getLastURL().Query(), KubectlSelectorParam, "forwarded")
+		})
+	}
+}
+
+func (s *ServiceTestSuite) TestService_Proxy_KubectlSelector_Invalid() {
+	client := HTTPClient{}
+	resp, err := client.Get(context.Background(), &(url.URL{
+		Scheme: "http", Host: s.service.cfg.ListenAddr, Path: "/podlist-status/redis.json",
+		RawQuery: url.Values{KubectlSelectorParam: {"Status"}}.Encode(),
+	}))
+	require.NoError(s.T(), err, "Get")
+	defer resp.Body.Close()
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func (s *ServiceTestSuite) TestCompareKubectlValues() {
+	tests := []struct {
+		actual interface{}
+		value  string
+		want   int
+	}{
+		{actual: int64(12), value: "5", want: 1},
+		{actual: "3 (5m ago)", value: "3", want: 0},
+		{actual: "1/2", value: "1", want: -1},
+		{actual: "2/2", value: "1", want: 0},
+		{actual: "3y45d", value: "400d", want: 1},
+		{actual: "2d3h", value: "51h", want: 0},
+		{actual: "5m10s", value: "1h", want: -1},
+		{actual: "Running", value: "Error", want: 1},
+	}
+	for _, tc := range tests {
+		cmp, comparable := compareKubectlValues(tc.actual, tc.value)
+		s.True(comparable, tc.actual)
+		s.Equal(tc.want, cmp, tc.actual)
+	}
+}
+
+func (s *ServiceTestSuite) TestParseKubectlSelector() {
+	tests := []struct {
+		text string
+		want kubectlRequirement
+	}{
+		{text: "Restarts>=5", want: kubectlRequirement{column: "Restarts", operator: ">=", value: "5"}},
+		{text: "Status==Running", want: kubectlRequirement{column: "Status", operator: "=", value: "Running"}},
+		{text: "Node!=a=b", want: kubectlRequirement{column: "Node", operator: "!=", value: "a=b"}},
+		{text: "Label=a!=b", want: kubectlRequirement{column: "Label", operator: "=", value: "a!=b"}},
+		{text: "Ready<1>0", want: kubectlRequirement{column: "Ready", operator: "<", value: "1>0"}},
+	}
+	for _, tc := range tests {
+		selector, err := parseKubectlSelector(tc.text)
+		require.NoError(s.T(), err, tc.text)
+		require.Equal(s.T(), kubectlSelector{tc.want}, selector, tc.text)
+	}
+
+	_, err := parseKubectlSelector("=Running")
+	require.ErrorIs(s.T(), err, configs.ErrInvalidKubectlSelector, "no column")
+}
+
+func (s *ServiceTestSuite) TestService_Proxy_KubectlOptions_UnsupportedKind() {
+	body := `{"kind":"ConfigMapList","apiVersion":"v1","metadata":{},"items":[` +
+		`{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":"b"}},` +
+		`{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":"a"}}]}`
+	cfg := s.service.cfg
+	cfg.ProxyTransport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return newTestResponse(r, http.StatusOK, body), nil
+	})
+
+	tests := []struct {
+		name        string
+		query       url.Values
+		streamLists bool
+		want        int
+	}{
+		{name: "Selector", query: url.Values{KubectlSelectorParam: {"Status=Running"}}, want: http.StatusBadRequest},
+		{
+			name: "Streamed selector", query: url.Values{KubectlSelectorParam: {"Status=Running"}}, streamLists: true,
+			want: http.StatusBadRequest,
+		},
+		{name: "SortBy", query: url.Values{KubectlSortByParam: {"Name"}}, want: http.StatusBadRequest},
+		{name: "Limit", query: url.Values{KubectlLimitParam: {"1"}}, want: http.StatusOK},
+	}
+	for _, tc := range tests {
+		cfg.StreamLists = tc.streamLists
+		s.setConfig(cfg)
+		client := HTTPClient{}
+		resp, err := client.Get(context.Background(), &(url.URL{
+			Scheme: "http", Host: s.service.cfg.ListenAddr, Path: "/api/v1/configmaps", RawQuery: tc.query.Encode(),
+		}))
+		require.NoError(s.T(), err, "Get")
+		gotBody, err := io.ReadAll(resp.Body)
+		require.NoError(s.T(), err, "ReadAll")
+		require.NoError(s.T(), resp.Body.Close(), "Close")
+		require.Equal(s.T(), tc.want, resp.StatusCode, tc.name)
+		if tc.want == http.StatusOK {
+			list := &unstructured.UnstructuredList{}
+			require.NoError(s.T(), list.UnmarshalJSON(gotBody), "UnmarshalJSON")
+			require.Len(s.T(), list.Items, 1, "limited")
+		} else {
+			require.Contains(s.T(), string(gotBody), configs.ErrUnsupportedKubectlKind.Error(), tc.name)
+		}
+	}
+}
+
+func (s *ServiceTestSuite) TestService_Proxy_KubectlOptions_EnrichmentFailed() {
+	body := brokenPodList(s)
+	cfg := s.service.cfg
+	cfg.EnrichmentStrict = true
+	cfg.ProxyTransport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return newTestResponse(r, http.StatusOK, body), nil
+	})
+	s.setConfig(cfg)
+
+	client := HTTPClient{}
+	resp, err := client.Get(context.Background(), &(url.URL{
+		Scheme: "http", Host: s.service.cfg.ListenAddr, Path: "/api/v1/namespaces/redis/pods",
+		RawQuery: url.Values{KubectlSelectorParam: {"Status=Running"}}.Encode(),
+	}))
+	require.NoError(s.T(), err, "Get")
+	require.NoError(s.T(), resp.Body.Close(), "Close")
+	require.Equal(s.T(), http.StatusInternalServerError, resp.StatusCode, "not filtered")
+}
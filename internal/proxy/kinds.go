@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/kubernetes/pkg/api/legacyscheme"
+	"k8s.io/kubernetes/pkg/printers"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// conditionsColumn is the extra printer column of Pods
+const conditionsColumn = "Conditions"
+
+// kindColumns is the validated column set of a kind
+type kindColumns struct {
+	groupKind schema.GroupKind
+	key       string
+	wide      bool
+	naming    string
+	// renames are the kept printer columns with the target names, nil keeps all columns
+	renames         map[string]string
+	jsonPathColumns []*customColumn
+}
+
+// defaultKindColumns keeps all wide printer columns in CamelCase under ObjectKeyKubectl
+func defaultKindColumns(groupKind schema.GroupKind) *kindColumns {
+	return &kindColumns{
+		groupKind: groupKind,
+		key:       configs.ObjectKeyKubectl,
+		wide:      true,
+		naming:    configs.ColumnNamingCamelCase,
+	}
+}
+
+// newKindColumns validates the column set by generating the printer columns of an empty object
+func newKindColumns(cfg configs.KindColumns, tableGenerator *printers.HumanReadableGenerator) (*kindColumns, error) {
+	if cfg.Kind == "" {
+		return nil, fmt.Errorf("%w: missing kind", configs.ErrInvalidKindColumns)
+	}
+	kc := defaultKindColumns(schema.GroupKind{Group: cfg.Group, Kind: cfg.Kind})
+
+	if cfg.Key != "" {
+		kc.key = cfg.Key
+	}
+	switch cfg.Output {
+	case "", configs.ColumnOutputWide:
+	case configs.ColumnOutputNormal:
+		kc.wide = false
+	default:
+		return nil, fmt.Errorf("%w: %s: invalid output: %s", configs.ErrInvalidKindColumns, kc.groupKind, cfg.Output)
+	}
+	switch cfg.Naming {
+	case "":
+	case configs.ColumnNamingCamelCase, configs.ColumnNamingSnakeCase, configs.ColumnNamingUpperCase:
+		kc.naming = cfg.Naming
+	default:
+		return nil, fmt.Errorf("%w: %s: invalid naming: %s", configs.ErrInvalidKindColumns, kc.groupKind, cfg.Naming)
+	}
+
+	obj, err := legacyscheme.Scheme.New(kc.groupKind.WithVersion(runtime.APIVersionInternal))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: unknown kind: %s", configs.ErrInvalidKindColumns, kc.groupKind, err)
+	}
+	table, err := tableGenerator.GenerateTable(obj, printers.GenerateOptions{Wide: kc.wide})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: no printer: %s", configs.ErrInvalidKindColumns, kc.groupKind, err)
+	}
+	printerColumns := []string{}
+	for _, column := range table.ColumnDefinitions {
+		printerColumns = append(printerColumns, column.Name)
+	}
+	if kc.groupKind == podGroupKind {
+		printerColumns = append(printerColumns, conditionsColumn)
+	}
+
+	if len(cfg.Columns) > 0 {
+		kc.renames = map[string]string{}
+		for _, column := range cfg.Columns {
+			if !containsString(printerColumns, column.Name) {
+				return nil, fmt.Errorf("%w: %s: unknown column: %s, valid columns: %s",
+					configs.ErrInvalidKindColumns, kc.groupKind, column.Name, strings.Join(printerColumns, ", "))
+			}
+			kc.renames[column.Name] = column.Rename
+		}
+	}
+	for _, column := range cfg.JSONPathColumns {
+		customColumn, err := newCustomColumn(column.Name, column.JSONPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", kc.groupKind, err)
+		}
+		kc.jsonPathColumns = append(kc.jsonPathColumns, customColumn)
+	}
+
+	return kc, nil
+}
+
+// columnName returns the target name of a printer column, false if the column is not kept
+func (kc *kindColumns) columnName(printerName string) (string, bool) {
+	if kc.renames != nil {
+		rename, has := kc.renames[printerName]
+		if !has {
+			return "", false
+		}
+		if rename != "" {
+			return rename, true
+		}
+	}
+
+	switch kc.naming {
+	case configs.ColumnNamingSnakeCase:
+		return strings.ToLower(strings.ReplaceAll(printerName, " ", "_")), true
+	case configs.ColumnNamingUpperCase:
+		return strings.ToUpper(strings.ReplaceAll(printerName, " ", "_")), true
+	default:
+		return FormatKubectlColumn(printerName), true
+	}
+}
+
+// printerValues returns the kept printer columns of the first row
+func (kc *kindColumns) printerValues(table *metav1.Table) map[string]interface{} {
+	values := map[string]interface{}{}
+	for c, column := range table.ColumnDefinitions {
+		if name, keep := kc.columnName(column.Name); keep {
+			values[name] = table.Rows[0].Cells[c]
+		}
+	}
+
+	return values
+}
+
+// addJSONPathValues adds the configured JSONPath columns
+func (kc *kindColumns) addJSONPathValues(item *unstructured.Unstructured, values map[string]interface{}) error {
+	for _, column := range kc.jsonPathColumns {
+		value, err := column.evaluate(item)
+		if err != nil {
+			return err
+		}
+		values[column.name] = value
+	}
+
+	return nil
+}
+
+// podGroupKind is the GroupKind of the Pods (core group)
+var podGroupKind = schema.GroupKind{Kind: "Pod"} // nolint:gochecknoglobals // constant
+
+// compileKinds validates the column sets and returns the column sets and the modifiers (the built-in and
+// the additional ones, see composeModifiers)
+func (s *Service) compileKinds(kinds []configs.KindColumns, additional []configs.Modifier,
+) (map[schema.GroupKind]*kindColumns, []configs.Modifier, error) {
+	kindColumnsByKind := map[schema.GroupKind]*kindColumns{}
+	builtins := []configs.Modifier{&kindModifier{groupKind: podGroupKind, modify: s.modifyPod}}
+	for _, kindCfg := range kinds {
+		kc, err := newKindColumns(kindCfg, s.tableGenerator)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, has := kindColumnsByKind[kc.groupKind]; !has && kc.groupKind != podGroupKind {
+			builtins = append(builtins, &kindModifier{groupKind: kc.groupKind, modify: s.modifyTable})
+		}
+		kindColumnsByKind[kc.groupKind] = kc
+	}
+
+	return kindColumnsByKind, composeModifiers(builtins, additional), nil
+}
+
+// kindColumnsOf returns the column set of the kind
+func (s *Service) kindColumnsOf(groupKind schema.GroupKind) *kindColumns {
+	s.mu.RLock()
+	kc, has := s.kinds[groupKind]
+	s.mu.RUnlock()
+	if has {
+		return kc
+	}
+
+	return defaultKindColumns(groupKind)
+}
+
+// generateTable generates the `kubectl get` row of the item
+func (s *Service) generateTable(item *unstructured.Unstructured, kc *kindColumns) (runtime.Object, *metav1.Table, error) {
+	obj, err := legacyscheme.Scheme.New(kc.groupKind.WithVersion(runtime.APIVersionInternal))
+	if err != nil {
+		return nil, nil, fmt.Errorf("new %s: %w", kc.groupKind, err)
+	}
+	if err := legacyscheme.Scheme.Convert(item, obj, item.GroupVersionKind()); err != nil {
+		return nil, nil, fmt.Errorf("fromunstructured %s: %w", kc.groupKind, err)
+	}
+
+	table, err := s.tableGenerator.GenerateTable(obj, printers.GenerateOptions{NoHeaders: false, Wide: kc.wide})
+	if err != nil {
+		return nil, nil, fmt.Errorf("generatetable: %w", err)
+	}
+	if len(table.Rows) < 1 {
+		return nil, nil, configs.ErrGenerateTableNoRow
+	}
+	if len(table.Rows) > 1 {
+		return nil, nil, configs.ErrGenerateTableMoreRows
+	}
+
+	return obj, table, nil
+}
+
+// modifyTable adds the printer columns to an item of a configured kind (other than Pod)
+func (s *Service) modifyTable(item *unstructured.Unstructured) error {
+	kc := s.kindColumnsOf(item.GroupVersionKind().GroupKind())
+	_, table, err := s.generateTable(item, kc)
+	if err != nil {
+		return err
+	}
+
+	values := kc.printerValues(table)
+	if err := kc.addJSONPathValues(item, values); err != nil {
+		return err
+	}
+
+	return s.addKubectlValues(item, values)
+}
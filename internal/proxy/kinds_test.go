@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"net/url"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// setKinds replaces the service by a new one with the column sets
+func (s *ServiceTestSuite) setKinds(kinds []configs.KindColumns) {
+	s.T().Helper()
+	cfg := s.service.cfg
+	cfg.Kinds = kinds
+	s.setConfig(cfg)
+}
+
+func (s *ServiceTestSuite) TestService_Proxy_KindColumns() {
+	kinds, err := configs.LoadKinds("../../test/configs/columns.yaml")
+	require.NoError(s.T(), err, "LoadKinds")
+	s.setKinds(kinds)
+
+	tests := []struct {
+		name     string
+		bodyFile string
+		key      string
+		want     map[string]map[string]interface{}
+	}{
+		{
+			name:     "Pod",
+			bodyFile: "/pod-status/Running2.json",
+			key:      "columns",
+			want: map[string]map[string]interface{}{
+				"node-exporter-s6tbv": {
+					"NAME": "node-exporter-s6tbv", "State": "Running", "NOMINATED_NODE": "<none>",
+					"Images": "quay.io/prometheus/node-exporter:v1.2.2,quay.io/brancz/kube-rbac-proxy:v0.11.0",
+				},
+			},
+		},
+		{
+			name:     "ServiceList",
+			bodyFile: "/svclist-status/monitoring.json",
+			key:      configs.ObjectKeyKubectl,
+			want: map[string]map[string]interface{}{
+				"prometheus-stack-grafana": {
+					"name": "prometheus-stack-grafana", "type": "ClusterIP", "cluster-ip": "10.96.159.248",
+					"external-ip": "<none>", "port(s)": "80/TCP", "age": "<unknown>",
+				},
+			},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			kubectlMaps := s.getKubectlMapsByKey(tc.bodyFile, url.Values{}, tc.key)
+			for name, want := range tc.want {
+				got := kubectlMaps[name]
+				delete(got, "age")
+				delete(want, "age")
+				require.Equal(s.T(), want, got, name)
+			}
+		})
+	}
+}
+
+func (s *ServiceTestSuite) TestService_New_InvalidKindColumns() {
+	tests := []struct {
+		name  string
+		kinds []configs.KindColumns
+	}{
+		{name: "Missing kind", kinds: []configs.KindColumns{{}}},
+		{name: "Unknown kind", kinds: []configs.KindColumns{{Kind: "Unknown"}}},
+		{name: "Unknown column", kinds: []configs.KindColumns{
+			{Kind: "Pod", Columns: []configs.PrinterColumn{{Name: "Unknown"}}},
+		}},
+		{name: "Wide column of normal output", kinds: []configs.KindColumns{
+			{Kind: "Pod", Output: configs.ColumnOutputNormal, Columns: []configs.PrinterColumn{{Name: "Node"}}},
+		}},
+		{name: "Invalid output", kinds: []configs.KindColumns{{Kind: "Pod", Output: "yaml"}}},
+		{name: "Invalid naming", kinds: []configs.KindColumns{{Kind: "Pod", Naming: "kebab-case"}}},
+		{name: "Invalid JSONPath", kinds: []configs.KindColumns{
+			{Kind: "Pod", JSONPathColumns: []configs.JSONPathColumn{{Name: "X", JSONPath: "{.spec"}}},
+		}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			cfg := s.service.cfg
+			cfg.Kinds = tc.kinds
+			_, err := New(cfg, s.service.log)
+			require.Error(s.T(), err, "New")
+		})
+	}
+}
+
+func (s *ServiceTestSuite) TestService_KindColumnsOf_Group() {
+	s.setKinds([]configs.KindColumns{{Kind: "Pod", Columns: []configs.PrinterColumn{{Name: "Name"}}}})
+
+	require.Same(s.T(), s.service.kinds[podGroupKind], s.service.kindColumnsOf(podGroupKind), "core Pod")
+	other := schema.GroupKind{Group: "example.com", Kind: "Pod"}
+	require.NotSame(s.T(), s.service.kinds[podGroupKind], s.service.kindColumnsOf(other), "example.com Pod")
+	require.Equal(s.T(), other, s.service.kindColumnsOf(other).groupKind, "example.com Pod")
+
+	builtin := &kindModifier{groupKind: podGroupKind}
+	require.True(s.T(), builtin.Matches(schema.GroupVersionKind{Version: "v1", Kind: "Pod"}), "core Pod")
+	require.False(s.T(), builtin.Matches(other.WithVersion("v1")), "example.com Pod")
+}
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// EnrichmentHeader is set on the responses, which are forwarded untouched,
+// because the body is too large, the Content-Encoding isn't supported, the client requested protobuf
+// or the enrichment failed,
+// and on the lists, which have items failed the enrichment (see modifyItems)
+const (
+	EnrichmentHeader          = "X-Kubeproxy-Enrichment"
+	EnrichmentSkipped         = "skipped; body too large"
+	EnrichmentSkippedEncoding = "skipped; unsupported encoding"
+	EnrichmentSkippedProtobuf = "skipped; protobuf client"
+	EnrichmentFailed          = "failed"
+	EnrichmentPartial         = "partial"
+)
+
+// Reasons of the untouched responses
+const (
+	SkipBodyTooLarge        = "body_too_large"
+	SkipUnsupportedEncoding = "unsupported_encoding"
+	SkipProtobufClient      = "protobuf_client"
+	SkipEnrichmentError     = "error"
+)
+
+var enrichmentSkipped = promauto.NewCounterVec(prometheus.CounterOpts{ // nolint:gochecknoglobals // registered once
+	Namespace: metricsNamespace,
+	Name:      "enrichment_skipped_total",
+	Help:      "Number of responses forwarded untouched by reason (body_too_large, unsupported_encoding, protobuf_client, error)",
+}, []string{"reason"})
+
+// maxBodySize returns the max size of an enrichable (decompressed) body, 0: unlimited
+func (s *Service) maxBodySize() int64 {
+	return atomic.LoadInt64(&s.maxBody)
+}
+
+// skipEnrichment marks the untouched response
+func (s *Service) skipEnrichment(resp *http.Response, reason string, keysAndValues ...interface{}) {
+	switch reason {
+	case SkipUnsupportedEncoding:
+		resp.Header.Set(EnrichmentHeader, EnrichmentSkippedEncoding)
+	case SkipProtobufClient:
+		resp.Header.Set(EnrichmentHeader, EnrichmentSkippedProtobuf)
+	default:
+		resp.Header.Set(EnrichmentHeader, EnrichmentSkipped)
+	}
+	enrichmentSkipped.WithLabelValues(reason).Inc()
+	reqURL := ""
+	if resp.Request != nil {
+		reqURL = resp.Request.URL.String()
+	}
+	s.log.Info("Enrichment skipped", append([]interface{}{"url", reqURL, "reason", reason}, keysAndValues...)...)
+}
+
+// failEnrichment marks the response, which is forwarded untouched, because the enrichment failed.
+// The error is added in Warning header, if EnrichmentWarnings is enabled.
+func (s *Service) failEnrichment(resp *http.Response, err error) {
+	resp.Header.Set(EnrichmentHeader, EnrichmentFailed)
+	enrichmentSkipped.WithLabelValues(SkipEnrichmentError).Inc()
+	reqURL := ""
+	if resp.Request != nil {
+		reqURL = resp.Request.URL.String()
+	}
+	s.log.Error(err, "ModifyResponse", "url", reqURL)
+	s.mu.RLock()
+	warnings := s.cfg.EnrichmentWarnings
+	s.mu.RUnlock()
+	if warnings {
+		addWarning(resp.Header, fmt.Sprintf("enrichment failed: %s", err))
+	}
+}
+
+// readLimited reads the body, but max limit bytes (0: unlimited)
+func readLimited(reader io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(reader) // nolint:wrapcheck // transparent
+	}
+	body, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return body, err // nolint:wrapcheck // transparent
+	}
+	if int64(len(body)) > limit {
+		return body, fmt.Errorf("%w: > %d", configs.ErrBodyTooLarge, limit)
+	}
+
+	return body, nil
+}
+
+// replayBody is the already read part of the original body, followed by the rest of it
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
+func newReplayBody(read []byte, body io.ReadCloser) io.ReadCloser {
+	return &replayBody{Reader: io.MultiReader(bytes.NewReader(read), body), Closer: body}
+}
+
+// sizeGuard limits the bytes read, but not consumed (buffered) by the stream decoder yet,
+// so the size of an item or a top-level field is limited. The error is kept.
+type sizeGuard struct {
+	reader   io.Reader
+	limit    int64
+	read     int64
+	consumed func() int64
+	err      error
+}
+
+func (g *sizeGuard) Read(p []byte) (int, error) {
+	if g.err != nil {
+		return 0, g.err
+	}
+	if g.limit > 0 {
+		buffered := g.read
+		if g.consumed != nil {
+			buffered -= g.consumed()
+		}
+		if buffered > g.limit {
+			g.err = fmt.Errorf("%w: > %d", configs.ErrBodyTooLarge, g.limit)
+
+			return 0, g.err
+		}
+		if maxRead := g.limit - buffered + 1; int64(len(p)) > maxRead {
+			p = p[:maxRead]
+		}
+	}
+	n, err := g.reader.Read(p)
+	g.read += int64(n)
+
+	return n, err // nolint:wrapcheck // transparent
+}
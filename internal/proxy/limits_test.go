@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+func (s *ServiceTestSuite) TestService_ModifyResponse_MaxBodySize() {
+	body, err := os.ReadFile("../../test/podlist-status/redis.json")
+	require.NoError(s.T(), err, "ReadFile")
+	gzipBody := bytes.Buffer{}
+	writer := gzip.NewWriter(&gzipBody)
+	_, err = writer.Write(body)
+	require.NoError(s.T(), err, "gzip Write")
+	require.NoError(s.T(), writer.Close(), "gzip Close")
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://127.0.0.1:8001/", http.NoBody)
+	require.NoError(s.T(), err, "NewRequest")
+
+	tests := []struct {
+		name            string
+		maxBodySize     int64
+		contentEncoding string
+		contentLength   int64
+		wantSkipped     bool
+	}{
+		{name: "Unlimited", contentLength: int64(len(body))},
+		{name: "Below", maxBodySize: int64(len(body)), contentLength: int64(len(body))},
+		{name: "Content-Length", maxBodySize: int64(len(body)) - 1, contentLength: int64(len(body)), wantSkipped: true},
+		{name: "Unknown length", maxBodySize: int64(len(body)) - 1, contentLength: -1, wantSkipped: true},
+		{name: "Gzip below", maxBodySize: int64(len(body)), contentEncoding: "gzip", contentLength: -1},
+		{
+			name: "Gzip decompressed", maxBodySize: int64(gzipBody.Len()) + 1, contentEncoding: "gzip",
+			contentLength: int64(gzipBody.Len()), wantSkipped: true,
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			cfg := s.service.cfg
+			cfg.MaxBodySize = tc.maxBodySize
+			s.setConfig(cfg)
+			resp := newListResponse(req, body, tc.contentEncoding)
+			resp.ContentLength = tc.contentLength
+			originalBody := body
+			if tc.contentEncoding != "" {
+				originalBody = gzipBody.Bytes()
+			}
+
+			require.NoError(s.T(), s.service.ModifyResponse(resp), "ModifyResponse")
+			gotBody, err := io.ReadAll(resp.Body)
+			require.NoError(s.T(), err, "ReadAll")
+			require.NoError(s.T(), resp.Body.Close(), "Close")
+
+			if tc.wantSkipped {
+				require.Equal(s.T(), EnrichmentSkipped, resp.Header.Get(EnrichmentHeader), EnrichmentHeader)
+				require.Equal(s.T(), tc.contentEncoding, resp.Header.Get("Content-Encoding"), "Content-Encoding")
+				require.Equal(s.T(), originalBody, gotBody, "Body")
+			} else {
+				require.Empty(s.T(), resp.Header.Get(EnrichmentHeader), EnrichmentHeader)
+				require.Empty(s.T(), resp.Header.Get("Content-Encoding"), "Content-Encoding")
+				require.Contains(s.T(), string(gotBody), `"`+configs.ObjectKeyKubectl+`"`, "Body")
+			}
+		})
+	}
+}
+
+func (s *ServiceTestSuite) TestService_ModifyResponse_MaxBodySize_Stream() {
+	body, err := os.ReadFile("../../test/podlist-status/redis.json")
+	require.NoError(s.T(), err, "ReadFile")
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://127.0.0.1:8001/", http.NoBody)
+	require.NoError(s.T(), err, "NewRequest")
+
+	cfg := s.service.cfg
+	cfg.StreamLists = true
+	cfg.MaxBodySize = int64(len(body)) / 2
+	s.setConfig(cfg)
+	resp := newListResponse(req, body, "")
+	resp.ContentLength = -1
+	require.NoError(s.T(), s.service.ModifyResponse(resp), "ModifyResponse")
+	gotBody, err := io.ReadAll(resp.Body)
+	require.NoError(s.T(), err, "ReadAll items below the limit")
+	require.Contains(s.T(), string(gotBody), `"`+configs.ObjectKeyKubectl+`"`, "Body")
+
+	cfg.MaxBodySize = 1024
+	s.setConfig(cfg)
+	resp = newListResponse(req, body, "")
+	resp.ContentLength = -1
+	require.NoError(s.T(), s.service.ModifyResponse(resp), "ModifyResponse")
+	_, err = io.ReadAll(resp.Body)
+	require.ErrorIs(s.T(), err, configs.ErrBodyTooLarge, "ReadAll item above the limit")
+}
+
+func (s *ServiceTestSuite) TestReadLimited() {
+	body, err := readLimited(bytes.NewReader([]byte("12345")), 5)
+	require.NoError(s.T(), err, "equal")
+	require.Equal(s.T(), "12345", string(body), "equal")
+
+	_, err = readLimited(bytes.NewReader([]byte("123456")), 5)
+	require.ErrorIs(s.T(), err, configs.ErrBodyTooLarge, "above")
+
+	body, err = readLimited(bytes.NewReader([]byte("123456")), 0)
+	require.NoError(s.T(), err, "unlimited")
+	require.Equal(s.T(), "123456", string(body), "unlimited")
+}
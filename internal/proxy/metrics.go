@@ -0,0 +1,184 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+const podMetricsAPI = "/apis/metrics.k8s.io/v1beta1"
+
+// Values of the Metrics column
+const (
+	MetricsAvailable   = "Available"
+	MetricsMissing     = "Missing"
+	MetricsUnavailable = "Unavailable"
+)
+
+// joinPodMetrics adds the usage (like `kubectl top pod`) to the Pods.
+// A single Pod gets only its own PodMetrics, Pods of a list get the PodMetrics of the namespace (or all namespaces).
+// If metrics.k8s.io API is not available, the Metrics column is set to Unavailable.
+func (s *Service) joinPodMetrics(ctx context.Context, req *http.Request, items []*unstructured.Unstructured,
+	isList bool,
+) {
+	var usages map[string]v1.ResourceList
+	var err error
+	if isList {
+		usages, err = s.getPodUsages(ctx, req, commonNamespace(items))
+	} else {
+		usages, err = s.getPodUsage(ctx, req, items[0])
+	}
+	if err != nil {
+		s.log.Error(err, "PodMetrics")
+	}
+
+	for _, item := range items {
+		s.setPodMetrics(item, usages, err)
+	}
+}
+
+// setPodMetrics adds the usage columns to a Pod, by the result of getPodUsages
+func (s *Service) setPodMetrics(item *unstructured.Unstructured, usages map[string]v1.ResourceList, usagesErr error) {
+	values := map[string]interface{}{}
+	usage, has := usages[item.GetNamespace()+"/"+item.GetName()]
+	switch {
+	case usagesErr != nil:
+		values[FormatKubectlColumn("Metrics")] = MetricsUnavailable
+	case !has:
+		values[FormatKubectlColumn("Metrics")] = MetricsMissing
+	default:
+		values[FormatKubectlColumn("Metrics")] = MetricsAvailable
+	}
+
+	reqs, limits, errRes := podRequestsAndLimits(item)
+	if errRes != nil {
+		s.log.Error(errRes, "PodMetrics")
+	}
+	for _, res := range podResources {
+		if res.name != v1.ResourceCPU && res.name != v1.ResourceMemory {
+			continue
+		}
+		setResourceColumns(values, res, "Usage", usage)
+		setUsagePercentColumn(values, res, "Requests", usage, reqs)
+		setUsagePercentColumn(values, res, "Limits", usage, limits)
+	}
+
+	if err := s.addKubectlValues(item, values); err != nil {
+		s.log.Error(err, "PodMetrics")
+	}
+}
+
+// getPodUsages returns the summarized container usages by namespace/name.
+// Namespaced PodMetrics are requested, if the namespace is set.
+func (s *Service) getPodUsages(ctx context.Context, req *http.Request, namespace string,
+) (map[string]v1.ResourceList, error) {
+	metricsPath := podMetricsAPI + "/pods"
+	if namespace != "" {
+		metricsPath = podMetricsAPI + "/namespaces/" + namespace + "/pods"
+	}
+
+	body, err := s.getUpstream(ctx, req, metricsPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	metricsList := &unstructured.UnstructuredList{}
+	if err := metricsList.UnmarshalJSON(body); err != nil {
+		return nil, fmt.Errorf("unmarshaljson podmetrics: %w", err)
+	}
+
+	usages := map[string]v1.ResourceList{}
+	for i := range metricsList.Items {
+		metrics := &metricsList.Items[i]
+		if usages[metrics.GetNamespace()+"/"+metrics.GetName()], err = podMetricsUsage(metrics); err != nil {
+			return nil, err
+		}
+	}
+
+	return usages, nil
+}
+
+// getPodUsage returns the summarized container usages of a single Pod, same to getPodUsages.
+// The PodMetrics of the Pod is requested. A Pod without PodMetrics (404 Not Found) has no usage.
+func (s *Service) getPodUsage(ctx context.Context, req *http.Request, item *unstructured.Unstructured,
+) (map[string]v1.ResourceList, error) {
+	key := item.GetNamespace() + "/" + item.GetName()
+	metricsPath := podMetricsAPI + "/namespaces/" + item.GetNamespace() + "/pods/" + item.GetName()
+	body, err := s.getUpstream(ctx, req, metricsPath, nil)
+	if errors.Is(err, configs.ErrResourceNotFound) {
+		return map[string]v1.ResourceList{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	metrics := &unstructured.Unstructured{}
+	if err := metrics.UnmarshalJSON(body); err != nil {
+		return nil, fmt.Errorf("unmarshaljson podmetrics: %w", err)
+	}
+	usage, err := podMetricsUsage(metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]v1.ResourceList{key: usage}, nil
+}
+
+// podMetricsUsage summarizes the container usages of a PodMetrics
+func podMetricsUsage(metrics *unstructured.Unstructured) (v1.ResourceList, error) {
+	containers, _, err := unstructured.NestedSlice(metrics.UnstructuredContent(), "containers")
+	if err != nil {
+		return nil, fmt.Errorf("podmetrics containers: %w", err)
+	}
+	usage := v1.ResourceList{}
+	for _, container := range containers {
+		containerMap, is := container.(map[string]interface{})
+		if !is {
+			continue
+		}
+		containerUsage, _, err := unstructured.NestedStringMap(containerMap, "usage")
+		if err != nil {
+			return nil, fmt.Errorf("podmetrics usage: %w", err)
+		}
+		for name, value := range containerUsage {
+			quantity, err := resource.ParseQuantity(value)
+			if err != nil {
+				return nil, fmt.Errorf("podmetrics usage %s: %w", name, err)
+			}
+			sum := usage[v1.ResourceName(name)]
+			sum.Add(quantity)
+			usage[v1.ResourceName(name)] = sum
+		}
+	}
+
+	return usage, nil
+}
+
+// setUsagePercentColumn sets the usage percentage of requests or limits, if both are known
+func setUsagePercentColumn(values map[string]interface{}, res podResource, kind string,
+	usage v1.ResourceList, list v1.ResourceList,
+) {
+	used, hasUsed := usage[res.name]
+	total, hasTotal := list[res.name]
+	if !hasUsed || !hasTotal || total.IsZero() {
+		return
+	}
+
+	values[FormatKubectlColumn(res.col+" Usage "+kind+" Percent")] = used.MilliValue() * 100 / total.MilliValue()
+}
+
+// commonNamespace returns the namespace of the items, if all items are in the same namespace
+func commonNamespace(items []*unstructured.Unstructured) string {
+	namespace := items[0].GetNamespace()
+	for _, item := range items {
+		if item.GetNamespace() != namespace {
+			return ""
+		}
+	}
+
+	return namespace
+}
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+func (s *ServiceTestSuite) TestService_Proxy_PodMetrics() {
+	s.service.cfg.PodMetrics = true
+	tests := []struct {
+		name     string
+		bodyFile string
+		want     map[string]map[string]interface{}
+	}{
+		{
+			name:     "Available",
+			bodyFile: "/podlist-status/redis.json",
+			want: map[string]map[string]interface{}{
+				"redisoperator-56d6888cc-ks84t": {
+					"Metrics":                 MetricsMissing,
+					"CPUUsage":                "<none>",
+					"CPUUsageMillicores":      nil,
+					"MemoryUsage":             "<none>",
+					"MemoryUsageBytes":        nil,
+					"CPUUsageRequestsPercent": nil,
+				},
+				"rfr-vcc-0": {
+					"Metrics":                    MetricsAvailable,
+					"CPUUsage":                   "50m",
+					"CPUUsageMillicores":         int64(50),
+					"CPUUsageRequestsPercent":    int64(50),
+					"CPUUsageLimitsPercent":      int64(12),
+					"MemoryUsage":                "200Mi",
+					"MemoryUsageBytes":           int64(200 * 1024 * 1024),
+					"MemoryUsageRequestsPercent": int64(200),
+					"MemoryUsageLimitsPercent":   int64(40),
+				},
+				"rfs-vcc-5cc6bf796c-g9mnr": {
+					"Metrics":                 MetricsAvailable,
+					"CPUUsageMillicores":      int64(5),
+					"CPUUsageRequestsPercent": int64(5),
+					"CPUUsageLimitsPercent":   int64(50),
+				},
+			},
+		},
+		{
+			name:     "Unavailable",
+			bodyFile: "/podlist-status/mongo.json",
+			want: map[string]map[string]interface{}{
+				"vcc-rs0-0": {
+					"Metrics":            MetricsUnavailable,
+					"CPUUsage":           "<none>",
+					"CPUUsageMillicores": nil,
+				},
+			},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			kubectlMaps := s.getKubectlMaps(tc.bodyFile, nil)
+
+			for name, want := range tc.want {
+				s.Contains(kubectlMaps, name)
+				for col, value := range want {
+					if value == nil {
+						s.NotContains(kubectlMaps[name], col, name+" "+col)
+					} else {
+						s.EqualValues(value, kubectlMaps[name][col], name+" "+col)
+					}
+				}
+			}
+		})
+	}
+}
+
+func (s *ServiceTestSuite) TestService_Proxy_PodMetrics_Single() {
+	tests := []struct {
+		name       string
+		statusCode int
+		want       string
+	}{
+		{name: "Available", statusCode: http.StatusOK, want: MetricsAvailable},
+		{name: "Missing", statusCode: http.StatusNotFound, want: MetricsMissing},
+		{name: "Unavailable", statusCode: http.StatusServiceUnavailable, want: MetricsUnavailable},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			metricsPaths := []string{}
+			cfg := s.service.cfg
+			cfg.PodMetrics = true
+			fileTransport := cfg.ProxyTransport
+			cfg.ProxyTransport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				if !strings.HasPrefix(r.URL.Path, podMetricsAPI) {
+					return fileTransport.RoundTrip(r)
+				}
+				metricsPaths = append(metricsPaths, r.URL.Path)
+
+				return newTestResponse(r, tc.statusCode, `{"kind":"PodMetrics","apiVersion":"metrics.k8s.io/v1beta1",`+
+					`"metadata":{"name":"node-exporter-s6tbv","namespace":"monitoring"},`+
+					`"containers":[{"name":"node-exporter","usage":{"cpu":"5m","memory":"20Mi"}}]}`), nil
+			})
+			s.setConfig(cfg)
+
+			kubectlMaps := s.getKubectlMaps("/pod-status/Running2.json", nil)
+			s.Equal([]string{podMetricsAPI + "/namespaces/monitoring/pods/node-exporter-s6tbv"}, metricsPaths, "path")
+			s.Equal(tc.want, kubectlMaps["node-exporter-s6tbv"]["Metrics"], "Metrics")
+			if tc.want == MetricsAvailable {
+				s.EqualValues(5, kubectlMaps["node-exporter-s6tbv"]["CPUUsageMillicores"], "CPUUsageMillicores")
+			}
+		})
+	}
+}
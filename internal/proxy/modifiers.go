@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// KubectlColumnsModifier is the name of the built-in modifiers of the kubectl columns
+const KubectlColumnsModifier = "kubectl-columns"
+
+// kindModifier is a built-in modifier of a kind (the kubectl columns), applied everywhere
+type kindModifier struct {
+	groupKind schema.GroupKind
+	modify    func(item *unstructured.Unstructured) error
+}
+
+func (m *kindModifier) Name() string { return KubectlColumnsModifier }
+func (m *kindModifier) Matches(gvk schema.GroupVersionKind) bool {
+	return gvk.GroupKind() == m.groupKind
+}
+func (m *kindModifier) Scope() configs.ModifierScope { return configs.ScopeAll }
+func (m *kindModifier) Order() int                   { return 0 }
+
+func (m *kindModifier) Modify(_ *http.Request, item *unstructured.Unstructured) error {
+	return m.modify(item)
+}
+
+// composeModifiers returns the built-in and the additional modifiers, sorted by Order.
+// The built-in modifiers run first by the same Order.
+func composeModifiers(builtins []configs.Modifier, additional []configs.Modifier) []configs.Modifier {
+	modifiers := append(append([]configs.Modifier{}, builtins...), additional...)
+	sort.SliceStable(modifiers, func(i, j int) bool {
+		return modifiers[i].Order() < modifiers[j].Order()
+	})
+
+	return modifiers
+}
+
+// modifierOf returns the modifiers of the kind and the scope, chained into one function.
+// Returns false, if there is no modifier.
+func (s *Service) modifierOf(req *http.Request, gvk schema.GroupVersionKind, scope configs.ModifierScope,
+) (func(item *unstructured.Unstructured) error, bool) {
+	s.mu.RLock()
+	modifiers := s.modifiers
+	s.mu.RUnlock()
+
+	chain := []configs.Modifier{}
+	for _, modifier := range modifiers {
+		if modifier.Scope()&scope != 0 && modifier.Matches(gvk) {
+			chain = append(chain, modifier)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, false
+	}
+
+	return func(item *unstructured.Unstructured) error {
+		for _, modifier := range chain {
+			if err := modifier.Modify(req, item); err != nil {
+				return fmt.Errorf("%s: %w", modifier.Name(), err)
+			}
+		}
+
+		return nil
+	}, true
+}
@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// traceModifier appends its name to the trace label of the Pods
+type traceModifier struct {
+	name  string
+	scope configs.ModifierScope
+	order int
+	err   error
+}
+
+func (m *traceModifier) Name() string                             { return m.name }
+func (m *traceModifier) Matches(gvk schema.GroupVersionKind) bool { return gvk.Kind == "Pod" }
+func (m *traceModifier) Scope() configs.ModifierScope             { return m.scope }
+func (m *traceModifier) Order() int                               { return m.order }
+
+func (m *traceModifier) Modify(req *http.Request, item *unstructured.Unstructured) error {
+	if req == nil || req.Context() == nil {
+		return errors.New("no request")
+	}
+	if m.err != nil {
+		return m.err
+	}
+	labels := item.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	if _, has := item.Object[configs.ObjectKeyKubectl]; has {
+		labels["trace"] += m.name + "+columns."
+	} else {
+		labels["trace"] += m.name + "."
+	}
+	item.SetLabels(labels)
+
+	return nil
+}
+
+func (s *ServiceTestSuite) setModifiers(modifiers ...configs.Modifier) {
+	s.T().Helper()
+	cfg := s.service.cfg
+	cfg.Modifiers = modifiers
+	s.setConfig(cfg)
+}
+
+func (s *ServiceTestSuite) TestService_Modifiers() {
+	s.setModifiers(
+		&traceModifier{name: "late", scope: configs.ScopeAll, order: 10},
+		&traceModifier{name: "list", scope: configs.ScopeList, order: 5},
+		&traceModifier{name: "early", scope: configs.ScopeAll, order: -1},
+		&traceModifier{name: "watch", scope: configs.ScopeWatch},
+	)
+
+	for _, streamLists := range []bool{false, true} {
+		s.service.cfg.StreamLists = streamLists
+		body, _ := s.getBody("/podlist-status/redis.json", nil)
+		podList := &unstructured.UnstructuredList{}
+		require.NoError(s.T(), podList.UnmarshalJSON(body), "UnmarshalJSON")
+		require.NotEmpty(s.T(), podList.Items, "items")
+		for _, item := range podList.Items {
+			require.Equal(s.T(), "early.list+columns.late+columns.", item.GetLabels()["trace"], "list order")
+		}
+	}
+
+	body, _ := s.getBody("/pod-status/Running.json", nil)
+	pod := &unstructured.Unstructured{}
+	require.NoError(s.T(), pod.UnmarshalJSON(body), "UnmarshalJSON")
+	require.Equal(s.T(), "early.late+columns.", pod.GetLabels()["trace"], "object scope")
+}
+
+func (s *ServiceTestSuite) TestService_Modifiers_Error() {
+	s.setModifiers(&traceModifier{name: "broken", scope: configs.ScopeAll, err: errors.New("unavailable")})
+	s.service.cfg.EnrichmentWarnings = true
+	s.service.cfg.StreamLists = false
+
+	_, resp := s.getBody("/podlist-status/redis.json", nil)
+	require.Equal(s.T(), EnrichmentPartial, resp.Header.Get(EnrichmentHeader), EnrichmentHeader)
+	require.Contains(s.T(), resp.Header.Get("Warning"), "broken: unavailable", "Warning")
+}
+
+// watchBody returns the JSON watch events of the Pods of a list file and a bookmark
+func watchBody(s *ServiceTestSuite, file string) (string, int) {
+	s.T().Helper()
+	body, err := os.ReadFile(file)
+	require.NoError(s.T(), err, "ReadFile")
+	podList := &unstructured.UnstructuredList{}
+	require.NoError(s.T(), podList.UnmarshalJSON(body), "UnmarshalJSON")
+	lines := []string{}
+	for i := range podList.Items {
+		podList.Items[i].SetKind("Pod")
+		podList.Items[i].SetAPIVersion("v1")
+		line, err := json.Marshal(map[string]interface{}{"type": "ADDED", "object": podList.Items[i].Object})
+		require.NoError(s.T(), err, "Marshal")
+		lines = append(lines, string(line))
+	}
+	lines = append(lines,
+		`{"type":"BOOKMARK","object":{"kind":"Pod","apiVersion":"v1","metadata":{"resourceVersion":"12345"}}}`)
+
+	return strings.Join(lines, "\n") + "\n", len(podList.Items)
+}
+
+func (s *ServiceTestSuite) TestService_Watch() {
+	body, pods := watchBody(s, "../../test/podlist-status/redis.json")
+	cfg := s.service.cfg
+	cfg.Modifiers = []configs.Modifier{
+		&traceModifier{name: "watch", scope: configs.ScopeWatch, order: 1},
+		&traceModifier{name: "list", scope: configs.ScopeList, order: 1},
+	}
+	cfg.ProxyTransport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return newTestResponse(r, http.StatusOK, body), nil
+	})
+	s.setConfig(cfg)
+
+	client := HTTPClient{}
+	resp, err := client.Get(context.Background(), &(url.URL{
+		Scheme: "http", Host: s.service.cfg.ListenAddr, Path: "/api/v1/namespaces/redis/pods", RawQuery: "watch=true",
+	}))
+	require.NoError(s.T(), err, "Get")
+	require.Equal(s.T(), http.StatusOK, resp.StatusCode, "StatusCode")
+	require.Empty(s.T(), resp.Header.Get("ETag"), "ETag")
+
+	events := []watchEvent{}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		event := watchEvent{}
+		require.NoError(s.T(), json.Unmarshal(scanner.Bytes(), &event), "Unmarshal")
+		events = append(events, event)
+	}
+	require.NoError(s.T(), scanner.Err(), "Scan")
+	require.NoError(s.T(), resp.Body.Close(), "Close")
+	require.Len(s.T(), events, pods+1, "events")
+
+	for _, event := range events[:pods] {
+		item := &unstructured.Unstructured{}
+		require.NoError(s.T(), item.UnmarshalJSON(event.Object), "UnmarshalJSON")
+		kubectlMap, _, err := unstructured.NestedMap(item.Object, configs.ObjectKeyKubectl)
+		require.NoError(s.T(), err, "NestedMap")
+		require.NotEmpty(s.T(), kubectlMap["Status"], "kubectl columns")
+		require.Equal(s.T(), "watch+columns.", item.GetLabels()["trace"], "watch scope")
+	}
+	require.JSONEq(s.T(), `{"kind":"Pod","apiVersion":"v1","metadata":{"resourceVersion":"12345"}}`,
+		string(events[pods].Object), "bookmark")
+}
+
+func (s *ServiceTestSuite) TestComposeModifiers() {
+	builtin := &kindModifier{groupKind: podGroupKind}
+	first := &traceModifier{name: "first", order: -5}
+	same := &traceModifier{name: "same"}
+	modifiers := composeModifiers([]configs.Modifier{builtin}, []configs.Modifier{same, first})
+	require.Equal(s.T(), []configs.Modifier{first, builtin, same}, modifiers, "order")
+}
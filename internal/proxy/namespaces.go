@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// NamespacesPathPrefix is the prefix of the fan-out list requests to namespaces, for users without
+// cluster-wide list permission. The rest of the path is the cluster-wide list path, for example:
+// curl '127.0.0.1:8003/kubeproxy-ext/v1/namespaces/api/v1/pods?namespaces=redis,mongo'
+// curl '127.0.0.1:8003/kubeproxy-ext/v1/namespaces/apis/apps/v1/deployments'
+const NamespacesPathPrefix = "/kubeproxy-ext/v1/namespaces/"
+
+// NamespacesParam is the comma separated list of the namespaces, default: Proxy.Namespaces
+const NamespacesParam = "namespaces"
+
+// serveNamespaces lists the namespaces concurrently and merges the lists.
+// The failed namespaces are reported in the metadata.namespaces field of the list.
+func (s *Service) serveNamespaces(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	s.mu.RLock()
+	namespaces := s.cfg.Namespaces
+	s.mu.RUnlock()
+	if text := query.Get(NamespacesParam); text != "" {
+		namespaces = strings.Split(text, ",")
+	}
+	if len(namespaces) == 0 {
+		writeError(w, http.StatusBadRequest,
+			fmt.Sprintf("%s: missing %s", configs.ErrInvalidNamespaces, NamespacesParam))
+
+		return
+	}
+
+	targets := make([]fanOutTarget, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		listPath, err := namespacedListPath(strings.TrimPrefix(r.URL.Path, NamespacesPathPrefix), namespace)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+
+			return
+		}
+		targets = append(targets, fanOutTarget{name: namespace, up: s.upstreamOf(r), listPath: listPath})
+	}
+
+	query.Del(NamespacesParam)
+	r = r.Clone(r.Context())
+	r.URL.RawQuery = query.Encode()
+	s.serveFanOut(w, r, targets, "namespaces")
+}
+
+// namespacedListPath inserts the namespace into a cluster-wide list path:
+// api/v1/pods --> /api/v1/namespaces/{namespace}/pods
+// apis/apps/v1/deployments --> /apis/apps/v1/namespaces/{namespace}/deployments
+func namespacedListPath(listPath string, namespace string) (string, error) {
+	if namespace == "" || strings.Contains(namespace, "/") {
+		return "", fmt.Errorf("%w: invalid namespace: '%s'", configs.ErrInvalidNamespaces, namespace)
+	}
+	parts := strings.Split(strings.Trim(listPath, "/"), "/")
+	prefixLen := 0
+	switch {
+	case len(parts) == 3 && parts[0] == "api": // nolint:gomnd // api/version/resource
+		prefixLen = 2
+	case len(parts) == 4 && parts[0] == "apis": // nolint:gomnd // apis/group/version/resource
+		prefixLen = 3
+	default:
+		return "", fmt.Errorf("%w: not a cluster-wide list path: %s", configs.ErrInvalidNamespaces, listPath)
+	}
+
+	return "/" + strings.Join(parts[:prefixLen], "/") + "/namespaces/" + namespace + "/" + parts[prefixLen], nil
+}
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+func (s *ServiceTestSuite) getNamespaces(reqPath string, query url.Values) (int, []byte) {
+	s.T().Helper()
+
+	return s.getEndpoint(NamespacesPathPrefix+reqPath, query)
+}
+
+func (s *ServiceTestSuite) TestService_Namespaces() {
+	tests := []struct {
+		name           string
+		namespaces     []string
+		query          url.Values
+		wantItems      map[string]int
+		wantNamespaces map[string]interface{}
+	}{
+		{
+			name:      "Query",
+			query:     url.Values{NamespacesParam: {"redis,mongo,missing"}, KubectlSelectorParam: {"Status=Running"}},
+			wantItems: map[string]int{"redis": 4, "mongo": 4},
+			wantNamespaces: map[string]interface{}{
+				"redis": ClusterResultSuccess, "mongo": ClusterResultSuccess, "missing": ClusterResultFailure,
+			},
+		},
+		{
+			name:           "Config",
+			namespaces:     []string{"redis"},
+			query:          url.Values{},
+			wantItems:      map[string]int{"redis": 5},
+			wantNamespaces: map[string]interface{}{"redis": ClusterResultSuccess},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			s.service.cfg.Namespaces = tc.namespaces
+			statusCode, respBody := s.getNamespaces("api/v1/pods", tc.query)
+			require.Equal(s.T(), http.StatusOK, statusCode, "StatusCode")
+
+			unstrList := &unstructured.UnstructuredList{}
+			require.NoError(s.T(), unstrList.UnmarshalJSON(respBody), "UnmarshalJSON")
+			gotItems := map[string]int{}
+			for _, item := range unstrList.Items {
+				gotItems[item.GetNamespace()]++
+				_, has, _ := unstructured.NestedMap(item.Object, configs.ObjectKeyKubectl)
+				require.True(s.T(), has, "enriched")
+			}
+			require.Equal(s.T(), tc.wantItems, gotItems, "items")
+
+			metadata := struct {
+				Metadata struct {
+					Namespaces []map[string]interface{} `json:"namespaces"`
+				} `json:"metadata"`
+			}{}
+			require.NoError(s.T(), json.Unmarshal(respBody, &metadata), "Unmarshal metadata")
+			statuses := map[string]interface{}{}
+			for _, namespace := range metadata.Metadata.Namespaces {
+				statuses[namespace["name"].(string)] = namespace["status"] // nolint:forcetypeassert // test
+			}
+			require.Equal(s.T(), tc.wantNamespaces, statuses, "namespaces")
+		})
+	}
+}
+
+func (s *ServiceTestSuite) TestService_Namespaces_Invalid() {
+	statusCode, _ := s.getNamespaces("api/v1/pods", url.Values{})
+	require.Equal(s.T(), http.StatusBadRequest, statusCode, "missing namespaces")
+
+	statusCode, _ = s.getNamespaces("api/v1/namespaces/redis/pods", url.Values{NamespacesParam: {"redis"}})
+	require.Equal(s.T(), http.StatusBadRequest, statusCode, "namespaced path")
+
+	statusCode, _ = s.getNamespaces("api/v1/pods", url.Values{NamespacesParam: {"missing"}})
+	require.Equal(s.T(), http.StatusBadGateway, statusCode, "all failed")
+}
+
+func (s *ServiceTestSuite) TestNamespacedListPath() {
+	tests := []struct {
+		listPath string
+		want     string
+		wantErr  bool
+	}{
+		{listPath: "api/v1/pods", want: "/api/v1/namespaces/ns/pods"},
+		{listPath: "/apis/apps/v1/deployments", want: "/apis/apps/v1/namespaces/ns/deployments"},
+		{listPath: "api/v1/namespaces/ns/pods", wantErr: true},
+		{listPath: "apis/apps/v1", wantErr: true},
+		{listPath: "version", wantErr: true},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.listPath, func() {
+			got, err := namespacedListPath(tc.listPath, "ns")
+			if tc.wantErr {
+				require.ErrorIs(s.T(), err, configs.ErrInvalidNamespaces, "err")
+			} else {
+				require.NoError(s.T(), err, "err")
+				require.Equal(s.T(), tc.want, got, "path")
+			}
+		})
+	}
+	_, err := namespacedListPath("api/v1/pods", "a/b")
+	require.ErrorIs(s.T(), err, configs.ErrInvalidNamespaces, "invalid namespace")
+}
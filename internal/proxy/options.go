@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// requestOptions are the own query parameters of the proxy.
+// They are removed from the forwarded request and passed to ModifyResponse by the request context.
+type requestOptions struct {
+	selector kubectlSelector
+	sortBy   []kubectlSortKey
+	limit    int
+	columns  []*customColumn
+	output   string
+	// raw are the own query parameters (encoded), the ETag depends on them, see etagOf
+	raw string
+}
+
+// anyKind returns true, if the options can be applied on items without modifier
+func (opts *requestOptions) anyKind() bool {
+	return len(opts.columns) > 0
+}
+
+// listOptions returns true, if the options change the items of a list
+func (opts *requestOptions) listOptions() bool {
+	return len(opts.selector) > 0 || len(opts.sortBy) > 0 || opts.limit > 0 || opts.output != ""
+}
+
+type requestOptionsKey struct{}
+
+// parseRequestOptions parses and removes the own query parameters of the request
+func parseRequestOptions(r *http.Request) (*http.Request, error) {
+	query := r.URL.Query()
+	own := url.Values{}
+	opts := &requestOptions{}
+	found := false
+	var err error
+
+	if text, has := query[KubectlSelectorParam]; has {
+		found = true
+		if opts.selector, err = parseKubectlSelector(text[0]); err != nil {
+			return r, err
+		}
+		own.Set(KubectlSelectorParam, text[0])
+		query.Del(KubectlSelectorParam)
+	}
+	if text, has := query[KubectlSortByParam]; has {
+		found = true
+		if opts.sortBy, err = parseKubectlSortBy(text[0]); err != nil {
+			return r, err
+		}
+		own.Set(KubectlSortByParam, text[0])
+		query.Del(KubectlSortByParam)
+	}
+	if text, has := query[KubectlLimitParam]; has {
+		found = true
+		if opts.limit, err = strconv.Atoi(text[0]); err != nil || opts.limit < 1 {
+			return r, fmt.Errorf("%w: %s", configs.ErrInvalidKubectlLimit, text[0])
+		}
+		own.Set(KubectlLimitParam, text[0])
+		query.Del(KubectlLimitParam)
+	}
+	if text, has := query[KubectlColumnsParam]; has {
+		found = true
+		if opts.columns, err = parseCustomColumns(text[0]); err != nil {
+			return r, err
+		}
+		own.Set(KubectlColumnsParam, text[0])
+		query.Del(KubectlColumnsParam)
+	}
+	if text, has := query[KubectlOutputParam]; has {
+		found = true
+		if opts.output = text[0]; opts.output != KubectlOutputColumns || len(opts.columns) == 0 {
+			return r, fmt.Errorf("%w: %s", configs.ErrInvalidKubectlOutput, text[0])
+		}
+		own.Set(KubectlOutputParam, text[0])
+		query.Del(KubectlOutputParam)
+	}
+
+	if !found {
+		return r, nil
+	}
+	opts.raw = own.Encode()
+	r = r.WithContext(context.WithValue(r.Context(), requestOptionsKey{}, opts))
+	reqURL := *r.URL
+	reqURL.RawQuery = query.Encode()
+	r.URL = &reqURL
+	r.RequestURI = r.URL.RequestURI()
+
+	return r, nil
+}
+
+// getRequestOptions returns the own query parameters of the request, the request can be nil
+func getRequestOptions(req *http.Request) *requestOptions {
+	if req != nil {
+		if opts, is := req.Context().Value(requestOptionsKey{}).(*requestOptions); is {
+			return opts
+		}
+	}
+
+	return &requestOptions{}
+}
@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// PaginatePathPrefix is the prefix of the list requests, which are paginated by the proxy: the continue tokens
+// are followed and the enriched pages are stitched into one list. The rest of the path is the list path,
+// the limit query parameter is the page size, for example:
+// curl '127.0.0.1:8003/kubeproxy-ext/v1/paginate/api/v1/pods?limit=100'
+const PaginatePathPrefix = "/kubeproxy-ext/v1/paginate/"
+
+// PagesHeader is the number of the pages of the stitched list
+const PagesHeader = "X-Kubeproxy-Pages"
+
+// paginateRetries is the max number of the fresh lists after an expired continue token (410 Gone)
+const paginateRetries = 3
+
+// servePaginate gets all pages of a list and applies the own query parameters (filtering, sorting, etc.)
+// on the stitched list. If a continue token is expired, the list is restarted from the first page.
+func (s *Service) servePaginate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET is supported")
+
+		return
+	}
+	r, err := parseRequestOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	cfg := s.config()
+	pageSize := cfg.PageSize
+	maxItems := cfg.PaginateMaxItems
+	query := r.URL.Query()
+	if text := query.Get("limit"); text != "" {
+		if pageSize, err = strconv.Atoi(text); err != nil || pageSize < 1 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("%s: limit: %s", configs.ErrInvalidPaginate, text))
+
+			return
+		}
+	}
+	if query.Get("watch") != "" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("%s: watch", configs.ErrInvalidPaginate))
+
+		return
+	}
+
+	listPath := "/" + strings.TrimPrefix(r.URL.Path, PaginatePathPrefix)
+	var unstrList *unstructured.UnstructuredList
+	var pages int
+	var failures *enrichFailures
+	for retry := 0; ; retry++ {
+		unstrList, pages, failures, err = s.getPages(r, listPath, query, pageSize, maxItems)
+		if !errors.Is(err, configs.ErrResourceExpired) || retry >= paginateRetries {
+			break
+		}
+		s.log.Info("Continue token expired, list restarted", "path", listPath, "retry", retry+1)
+	}
+	if err != nil {
+		s.log.Error(err, "Paginate", "path", listPath)
+		writeError(w, upstreamErrorCode(err), err.Error())
+
+		return
+	}
+
+	w.Header().Set(PagesHeader, strconv.Itoa(pages))
+	body, err := s.finishList(unstrList, getRequestOptions(r), w.Header())
+	if err != nil {
+		s.log.Error(err, "Paginate")
+		writeError(w, listErrorCode(err), err.Error())
+
+		return
+	}
+
+	s.warnFailures(w.Header(), failures)
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(body); err != nil {
+		s.log.Error(err, "Paginate")
+	}
+}
+
+// getPages gets the pages of a list from the first one, enriches the pages one by one and stitches the items.
+// If maxItems (0: unlimited) is reached, the list is truncated: the continue token
+// and the remainingItemCount of the last page are kept in the metadata.
+// The size of the stitched pages is limited by the MaxBodySize, too: the page above the limit is dropped,
+// the continue token and the remainingItemCount of the previous page are kept.
+// The number of the stitched pages and the failed items of the pages are returned.
+func (s *Service) getPages(r *http.Request, listPath string, query url.Values, pageSize int, maxItems int,
+) (*unstructured.UnstructuredList, int, *enrichFailures, error) {
+	pageQuery := url.Values{}
+	for key, values := range query {
+		pageQuery[key] = values
+	}
+	pageQuery.Del("continue")
+	opts := getRequestOptions(r)
+	cluster := s.upstreamOf(r).name
+	stitched := &unstructured.UnstructuredList{Object: map[string]interface{}{}}
+	pages := 0
+	maxSize := s.maxBodySize()
+	size := int64(0)
+	var remaining *int64
+	var failures *enrichFailures
+	for {
+		limit := pageSize
+		if maxItems > 0 && maxItems-len(stitched.Items) < limit {
+			limit = maxItems - len(stitched.Items)
+		}
+		pageQuery.Set("limit", strconv.Itoa(limit))
+		body, err := s.getUpstream(r.Context(), r, listPath, pageQuery)
+		size += int64(len(body))
+		if pages > 0 && maxSize > 0 && (size > maxSize || errors.Is(err, configs.ErrBodyTooLarge)) {
+			stitched.SetContinue(pageQuery.Get("continue"))
+			stitched.SetRemainingItemCount(remaining)
+
+			break
+		}
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("page %d: %w", pages+1, err)
+		}
+		page := &unstructured.UnstructuredList{}
+		if err := page.UnmarshalJSON(body); err != nil {
+			return nil, 0, nil, fmt.Errorf("page %d: unmarshaljson list: %w", pages+1, err)
+		}
+		pages++
+		if pages == 1 {
+			stitched.SetKind(page.GetKind())
+			stitched.SetAPIVersion(page.GetAPIVersion())
+			stitched.SetResourceVersion(page.GetResourceVersion())
+		}
+		if len(page.Items) > 0 {
+			_, pageFailures, err := s.enrichList(r, page, opts, cluster)
+			failures = failures.merge(pageFailures)
+			if err != nil {
+				return nil, 0, nil, fmt.Errorf("page %d: %w", pages, err)
+			}
+		}
+		stitched.Items = append(stitched.Items, page.Items...)
+
+		next := page.GetContinue()
+		if next == "" {
+			break
+		}
+		if maxItems > 0 && len(stitched.Items) >= maxItems {
+			stitched.SetContinue(next)
+			stitched.SetRemainingItemCount(page.GetRemainingItemCount())
+
+			break
+		}
+		pageQuery.Set("continue", next)
+		remaining = page.GetRemainingItemCount()
+	}
+
+	return stitched, pages, failures, nil
+}
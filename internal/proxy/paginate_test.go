@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// pagingTransport serves the items of a list file by the limit and continue query parameters.
+// The continue token is the index of the next item. The first expired requests with continue token get 410 Gone.
+type pagingTransport struct {
+	items   []json.RawMessage
+	mu      sync.Mutex
+	expired int
+	pages   int
+}
+
+func newPagingTransport(s *ServiceTestSuite, file string, expired int) *pagingTransport {
+	s.T().Helper()
+	body, err := os.ReadFile(file)
+	require.NoError(s.T(), err, "ReadFile")
+	list := struct {
+		Items []json.RawMessage `json:"items"`
+	}{}
+	require.NoError(s.T(), json.Unmarshal(body, &list), "Unmarshal")
+
+	return &pagingTransport{items: list.Items, expired: expired}
+}
+
+func (t *pagingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pages++
+	query := r.URL.Query()
+	begin, _ := strconv.Atoi(query.Get("continue")) // nolint:errcheck // empty: 0
+	limit, _ := strconv.Atoi(query.Get("limit"))    // nolint:errcheck // checked by the value
+	if query.Get("continue") != "" && t.expired > 0 {
+		t.expired--
+
+		return newTestResponse(r, http.StatusGone, `{"kind":"Status","reason":"Expired"}`), nil
+	}
+
+	end := begin + limit
+	metadata := map[string]interface{}{"resourceVersion": "100"}
+	if limit == 0 || end >= len(t.items) {
+		end = len(t.items)
+	} else {
+		metadata["continue"] = strconv.Itoa(end)
+		metadata["remainingItemCount"] = len(t.items) - end
+	}
+	body, _ := json.Marshal(map[string]interface{}{ // nolint:errcheck // test
+		"kind": "PodList", "apiVersion": "v1", "metadata": metadata, "items": t.items[begin:end],
+	})
+
+	return newTestResponse(r, http.StatusOK, string(body)), nil
+}
+
+func newTestResponse(r *http.Request, statusCode int, body string) *http.Response {
+	return &http.Response{
+		StatusCode:    statusCode,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader([]byte(body))),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}
+}
+
+func (s *ServiceTestSuite) setPagingTransport(transport *pagingTransport, maxItems int) {
+	s.T().Helper()
+	cfg := s.service.cfg
+	cfg.ProxyTransport = transport
+	cfg.PageSize = 2
+	cfg.PaginateMaxItems = maxItems
+	s.setConfig(cfg)
+}
+
+func (s *ServiceTestSuite) getPaginate(query url.Values) (int, *unstructured.UnstructuredList, http.Header) {
+	s.T().Helper()
+	client := HTTPClient{}
+	resp, err := client.Get(context.Background(), &(url.URL{
+		Scheme: "http", Host: s.service.cfg.ListenAddr, Path: PaginatePathPrefix + "api/v1/pods", RawQuery: query.Encode(),
+	}))
+	require.NoError(s.T(), err, "Get")
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(s.T(), err, "ReadAll resp.Body")
+	require.NoError(s.T(), resp.Body.Close(), "Close resp.Body")
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil, resp.Header
+	}
+	unstrList := &unstructured.UnstructuredList{}
+	require.NoError(s.T(), unstrList.UnmarshalJSON(respBody), "UnmarshalJSON")
+
+	return resp.StatusCode, unstrList, resp.Header
+}
+
+func (s *ServiceTestSuite) TestService_Paginate() {
+	transport := newPagingTransport(s, "../../test/podlist-status/redis.json", 0)
+	s.setPagingTransport(transport, 0)
+
+	statusCode, unstrList, header := s.getPaginate(url.Values{KubectlSortByParam: {"Name"}})
+	require.Equal(s.T(), http.StatusOK, statusCode, "StatusCode")
+	require.Len(s.T(), unstrList.Items, len(transport.items), "items")
+	require.Equal(s.T(), 3, transport.pages, "pages by PageSize")
+	require.Equal(s.T(), "3", header.Get(PagesHeader), PagesHeader)
+	require.NotContains(s.T(), unstrList.Object["metadata"], "pages", "metadata.pages")
+	require.Equal(s.T(), "100", unstrList.GetResourceVersion(), "resourceVersion")
+	require.Empty(s.T(), unstrList.GetContinue(), "continue")
+	for _, item := range unstrList.Items {
+		_, has := item.Object[configs.ObjectKeyKubectl]
+		require.True(s.T(), has, "enriched "+item.GetName())
+	}
+
+	transport.pages = 0
+	statusCode, unstrList, _ = s.getPaginate(url.Values{"limit": {"4"}})
+	require.Equal(s.T(), http.StatusOK, statusCode, "StatusCode limit")
+	require.Len(s.T(), unstrList.Items, len(transport.items), "items limit")
+	require.Equal(s.T(), 2, transport.pages, "pages by limit")
+}
+
+func (s *ServiceTestSuite) TestService_Paginate_MaxItems() {
+	transport := newPagingTransport(s, "../../test/podlist-status/redis.json", 0)
+	s.setPagingTransport(transport, 3)
+
+	statusCode, unstrList, _ := s.getPaginate(url.Values{})
+	require.Equal(s.T(), http.StatusOK, statusCode, "StatusCode")
+	require.Len(s.T(), unstrList.Items, 3, "items")
+	require.Equal(s.T(), "3", unstrList.GetContinue(), "continue")
+	require.Equal(s.T(), int64(2), *unstrList.GetRemainingItemCount(), "remainingItemCount")
+}
+
+func (s *ServiceTestSuite) TestService_Paginate_MaxBodySize() {
+	transport := newPagingTransport(s, "../../test/podlist-status/redis.json", 0)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://localhost/api/v1/pods?limit=2",
+		http.NoBody)
+	require.NoError(s.T(), err, "NewRequest")
+	firstPage, err := transport.RoundTrip(req)
+	require.NoError(s.T(), err, "RoundTrip")
+	transport.pages = 0
+	s.setPagingTransport(transport, 0)
+	cfg := s.service.cfg
+	cfg.MaxBodySize = firstPage.ContentLength + 1
+	s.setConfig(cfg)
+
+	statusCode, unstrList, header := s.getPaginate(url.Values{})
+	require.Equal(s.T(), http.StatusOK, statusCode, "StatusCode")
+	require.Len(s.T(), unstrList.Items, 2, "items")
+	require.Equal(s.T(), "1", header.Get(PagesHeader), PagesHeader)
+	require.Equal(s.T(), "2", unstrList.GetContinue(), "continue")
+	require.Equal(s.T(), int64(3), *unstrList.GetRemainingItemCount(), "remainingItemCount")
+}
+
+func (s *ServiceTestSuite) TestService_Paginate_Expired() {
+	transport := newPagingTransport(s, "../../test/podlist-status/redis.json", 1)
+	s.setPagingTransport(transport, 0)
+
+	statusCode, unstrList, _ := s.getPaginate(url.Values{})
+	require.Equal(s.T(), http.StatusOK, statusCode, "StatusCode")
+	require.Len(s.T(), unstrList.Items, len(transport.items), "restarted")
+
+	transport.expired = paginateRetries + 1
+	statusCode, _, _ = s.getPaginate(url.Values{})
+	require.Equal(s.T(), http.StatusGone, statusCode, "always expired")
+}
+
+func (s *ServiceTestSuite) TestService_Paginate_Invalid() {
+	s.setPagingTransport(newPagingTransport(s, "../../test/podlist-status/redis.json", 0), 0)
+
+	statusCode, _, _ := s.getPaginate(url.Values{"limit": {"0"}})
+	require.Equal(s.T(), http.StatusBadRequest, statusCode, "limit")
+	statusCode, _, _ = s.getPaginate(url.Values{"watch": {"true"}})
+	require.Equal(s.T(), http.StatusBadRequest, statusCode, "watch")
+	statusCode, _, _ = s.getPaginate(url.Values{KubectlLimitParam: {"x"}})
+	require.Equal(s.T(), http.StatusBadRequest, statusCode, "own option")
+}
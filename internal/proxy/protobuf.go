@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+// ContentTypeProtobuf is the Content-Type of the Kubernetes protobuf encoding
+const ContentTypeProtobuf = runtime.ContentTypeProtobuf
+
+// upstreamProtobufAccept is the Accept header of the forwarded request, if UpstreamProtobuf is enabled.
+// The API server falls back to JSON for the kinds without protobuf encoding (for example: CRDs).
+const upstreamProtobufAccept = ContentTypeProtobuf + ", application/json"
+
+// protobufSerializer decodes the protobuf bodies of the built-in kinds
+var protobufSerializer = protobuf.NewSerializer( // nolint:gochecknoglobals // constant
+	clientgoscheme.Scheme, clientgoscheme.Scheme,
+)
+
+// clientAcceptKey is the context key of the original Accept header, if the forwarded Accept was rewritten
+type clientAcceptKey struct{}
+
+// isProtobuf returns true, if the Content-Type is the Kubernetes protobuf encoding
+func isProtobuf(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	return err == nil && mediaType == ContentTypeProtobuf
+}
+
+// acceptsJSON returns true, if the Accept header allows JSON and the client doesn't prefer protobuf.
+// The media ranges are checked in the order of the header, the first matching range wins.
+func acceptsJSON(accept string) bool {
+	if strings.TrimSpace(accept) == "" {
+		return true
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		switch mediaType {
+		case ContentTypeProtobuf:
+			return false
+		case "application/json", "application/*", "*/*":
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientAccept returns the Accept header, which was sent by the client, the request can be nil
+func clientAccept(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	if accept, is := req.Context().Value(clientAcceptKey{}).(string); is {
+		return accept
+	}
+
+	return req.Header.Get("Accept")
+}
+
+// requestProtobuf rewrites the Accept header of a GET request to protobuf, if UpstreamProtobuf is enabled,
+// the client accepts JSON and the API group is built-in (see builtinGroupVersion).
+// The protobuf response is converted back to JSON by ModifyResponse.
+// Watch requests are forwarded untouched, because the protobuf watch events are framed.
+// Requests of a different representation (for example: as=Table) are forwarded untouched, too.
+func (s *Service) requestProtobuf(r *http.Request) *http.Request {
+	s.mu.RLock()
+	enabled := s.cfg.UpstreamProtobuf
+	s.mu.RUnlock()
+	accept := r.Header.Get("Accept")
+	if !enabled || r.Method != http.MethodGet || !acceptsJSON(accept) || strings.Contains(accept, "as=") || isWatch(r) ||
+		!builtinGroupVersion(r.URL.Path) {
+		return r
+	}
+
+	r = r.Clone(context.WithValue(r.Context(), clientAcceptKey{}, accept))
+	r.Header.Set("Accept", upstreamProtobufAccept)
+
+	return r
+}
+
+// builtinGroupVersion returns true, if the API group version of the request path is registered in the scheme
+// of the built-in kinds, so its protobuf responses can be converted to JSON.
+// Other groups (for example: metrics.k8s.io, CRDs) may send protobuf, which can't be decoded.
+func builtinGroupVersion(reqPath string) bool {
+	parts := strings.Split(strings.Trim(reqPath, "/"), "/")
+	var groupVersion schema.GroupVersion
+	switch {
+	case len(parts) >= 2 && parts[0] == "api": // nolint:gomnd // api/{version}
+		groupVersion = schema.GroupVersion{Version: parts[1]}
+	case len(parts) >= 3 && parts[0] == "apis": // nolint:gomnd // apis/{group}/{version}
+		groupVersion = schema.GroupVersion{Group: parts[1], Version: parts[2]}
+	default:
+		return false
+	}
+
+	return clientgoscheme.Scheme.IsVersionRegistered(groupVersion)
+}
+
+// refetchJSON requests again the response by the Accept header of the client, if it was rewritten to protobuf
+// (see requestProtobuf), and runs ModifyResponse on the new response. It's used, if the protobuf body
+// can't be sent to the JSON client. Returns false, if the Accept header wasn't rewritten.
+func (s *Service) refetchJSON(resp *http.Response) (bool, error) {
+	if resp.Request == nil {
+		return false, nil
+	}
+	accept, rewritten := resp.Request.Context().Value(clientAcceptKey{}).(string)
+	if !rewritten {
+		return false, nil
+	}
+
+	// The cleared key prevents a repeated refetch, if the upstream sends protobuf again.
+	req := resp.Request.Clone(context.WithValue(resp.Request.Context(), clientAcceptKey{}, nil))
+	if accept == "" {
+		req.Header.Del("Accept")
+	} else {
+		req.Header.Set("Accept", accept)
+	}
+	resp.Body.Close() // nolint:errcheck,gosec // replaced by the refetched body
+	refetched, err := s.upstreamOf(req).proxy.Transport.RoundTrip(req)
+	if err != nil {
+		return true, fmt.Errorf("refetch json: %w", err)
+	}
+	resp.Status = refetched.Status
+	resp.StatusCode = refetched.StatusCode
+	resp.Header = refetched.Header
+	resp.Body = refetched.Body
+	resp.ContentLength = refetched.ContentLength
+	resp.Request = req
+
+	return true, s.ModifyResponse(resp)
+}
+
+// protobufToJSON decodes a protobuf body of a built-in kind and encodes it to JSON,
+// in the same form as the API server does.
+func protobufToJSON(body []byte) ([]byte, error) {
+	obj, gvk, err := protobufSerializer.Decode(body, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("protobuf decode: %w", err)
+	}
+	obj.GetObjectKind().SetGroupVersionKind(*gvk)
+	jsonBody, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("protobuf to json: %w", err)
+	}
+
+	return jsonBody, nil
+}
@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+func (s *ServiceTestSuite) TestAcceptsJSON() {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{accept: "", want: true},
+		{accept: "application/json", want: true},
+		{accept: "application/json, */*", want: true},
+		{accept: "*/*", want: true},
+		{accept: "application/json;as=Table;v=v1;g=meta.k8s.io, application/json", want: true},
+		{accept: "application/vnd.kubernetes.protobuf, */*", want: false},
+		{accept: "application/vnd.kubernetes.protobuf;q=0, application/json", want: true},
+		{accept: "application/yaml", want: false},
+	}
+	for _, tc := range tests {
+		require.Equal(s.T(), tc.want, acceptsJSON(tc.accept), tc.accept)
+	}
+}
+
+func (s *ServiceTestSuite) TestService_RequestProtobuf() {
+	cfg := s.service.cfg
+	cfg.UpstreamProtobuf = true
+	s.setConfig(cfg)
+
+	tests := []struct {
+		name     string
+		url      string
+		accept   string
+		rewrites bool
+	}{
+		{name: "JSON", url: "/api/v1/pods", accept: "application/json", rewrites: true},
+		{name: "No Accept", url: "/api/v1/pods", rewrites: true},
+		{name: "Protobuf client", url: "/api/v1/pods", accept: "application/vnd.kubernetes.protobuf, */*"},
+		{name: "Table", url: "/api/v1/pods", accept: "application/json;as=Table;v=v1;g=meta.k8s.io"},
+		{name: "Watch", url: "/api/v1/pods?watch=true", accept: "application/json"},
+		{name: "Watch 1", url: "/api/v1/pods?watch=1", accept: "application/json"},
+		{name: "Watch false", url: "/api/v1/pods?watch=false", accept: "application/json", rewrites: true},
+		{name: "Built-in group", url: "/apis/apps/v1/deployments", accept: "application/json", rewrites: true},
+		{name: "Metrics", url: "/apis/metrics.k8s.io/v1beta1/pods", accept: "application/json"},
+		{name: "CRD", url: "/apis/example.com/v1/widgets", accept: "application/json"},
+	}
+	for _, tc := range tests {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+			"http://127.0.0.1:8001"+tc.url, http.NoBody)
+		require.NoError(s.T(), err, "NewRequest")
+		if tc.accept != "" {
+			req.Header.Set("Accept", tc.accept)
+		}
+		upReq := s.service.requestProtobuf(req)
+		require.Equal(s.T(), tc.accept, clientAccept(upReq), tc.name)
+		if tc.rewrites {
+			require.Equal(s.T(), upstreamProtobufAccept, upReq.Header.Get("Accept"), tc.name)
+		} else {
+			require.Equal(s.T(), tc.accept, upReq.Header.Get("Accept"), tc.name)
+		}
+	}
+
+	cfg.UpstreamProtobuf = false
+	s.setConfig(cfg)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+		"http://127.0.0.1:8001/api/v1/pods", http.NoBody)
+	require.NoError(s.T(), err, "NewRequest")
+	require.Empty(s.T(), s.service.requestProtobuf(req).Header.Get("Accept"), "disabled")
+}
+
+func (s *ServiceTestSuite) TestService_ModifyResponse_Protobuf() {
+	body := protobufPodList(s, "../../test/podlist-status/redis.json")
+
+	tests := []struct {
+		name            string
+		accept          string
+		contentEncoding string
+		body            []byte
+		wantJSON        bool
+	}{
+		{name: "JSON client", accept: "application/json", body: body, wantJSON: true},
+		{name: "Gzip", accept: "application/json", contentEncoding: "gzip", body: body, wantJSON: true},
+		{name: "Protobuf client", accept: "application/vnd.kubernetes.protobuf, */*", body: body},
+		{name: "Invalid", accept: "application/json", body: []byte("k8s\x00invalid")},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+				"http://127.0.0.1:8001/", http.NoBody)
+			require.NoError(s.T(), err, "NewRequest")
+			req.Header.Set("Accept", tc.accept)
+			resp := newListResponse(req, tc.body, tc.contentEncoding)
+			resp.Header.Set("Content-Type", ContentTypeProtobuf)
+
+			require.NoError(s.T(), s.service.ModifyResponse(resp), "ModifyResponse")
+			gotBody, err := io.ReadAll(resp.Body)
+			require.NoError(s.T(), err, "ReadAll")
+			require.NoError(s.T(), resp.Body.Close(), "Close")
+
+			if tc.wantJSON {
+				require.Equal(s.T(), "application/json", resp.Header.Get("Content-Type"), "Content-Type")
+				require.Contains(s.T(), string(gotBody), `"kind":"PodList"`, "Body")
+				require.Contains(s.T(), string(gotBody), `"`+configs.ObjectKeyKubectl+`"`, "Body")
+			} else {
+				require.Equal(s.T(), ContentTypeProtobuf, resp.Header.Get("Content-Type"), "Content-Type")
+				require.Equal(s.T(), tc.body, gotBody, "Body")
+			}
+		})
+	}
+}
+
+func (s *ServiceTestSuite) TestService_ModifyResponse_ProtobufRefetch() {
+	body := protobufPodList(s, "../../test/podlist-status/redis.json")
+
+	tests := []struct {
+		name        string
+		body        []byte
+		maxBodySize int64
+		wantHeader  string
+	}{
+		{name: "Invalid", body: []byte("k8s\x00invalid")},
+		{name: "Too large", body: body, maxBodySize: 100, wantHeader: EnrichmentSkipped},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			cfg := s.service.cfg
+			cfg.MaxBodySize = tc.maxBodySize
+			s.setConfig(cfg)
+			req, err := http.NewRequestWithContext(
+				context.WithValue(context.Background(), clientAcceptKey{}, "application/json"), http.MethodGet,
+				"http://127.0.0.1:8001/api/v1/namespaces/redis/pods", http.NoBody)
+			require.NoError(s.T(), err, "NewRequest")
+			req.Header.Set("Accept", upstreamProtobufAccept)
+			resp := newListResponse(req, tc.body, "")
+			resp.Header.Set("Content-Type", ContentTypeProtobuf)
+
+			require.NoError(s.T(), s.service.ModifyResponse(resp), "ModifyResponse")
+			gotBody, err := io.ReadAll(resp.Body)
+			require.NoError(s.T(), err, "ReadAll")
+			require.NoError(s.T(), resp.Body.Close(), "Close")
+
+			require.Contains(s.T(), resp.Header.Get("Content-Type"), "application/json", "Content-Type")
+			require.Equal(s.T(), tc.wantHeader, resp.Header.Get(EnrichmentHeader), EnrichmentHeader)
+			require.Contains(s.T(), string(gotBody), `"metadata"`, "JSON body")
+			if tc.wantHeader == "" {
+				require.Contains(s.T(), string(gotBody), `"`+configs.ObjectKeyKubectl+`"`, "Enriched")
+			}
+		})
+	}
+}
+
+// protobufPodList encodes a Pod list file to protobuf, as the API server does
+func protobufPodList(s *ServiceTestSuite, file string) []byte {
+	s.T().Helper()
+	jsonBody, err := os.ReadFile(file)
+	require.NoError(s.T(), err, "ReadFile")
+	podList := &v1.PodList{}
+	require.NoError(s.T(), json.Unmarshal(jsonBody, podList), "Unmarshal")
+	// the fixtures are kubectl outputs (kind: List), the API server sends the typed list
+	podList.TypeMeta = metav1.TypeMeta{Kind: "PodList", APIVersion: "v1"}
+	buf := bytes.Buffer{}
+	require.NoError(s.T(), protobufSerializer.Encode(podList, &buf), "Encode")
+
+	return buf.Bytes()
+}
+
+func (s *ServiceTestSuite) TestService_Proxy_ProtobufRefetch() {
+	body := protobufPodList(s, "../../test/podlist-status/redis.json")
+	jsonBody, err := os.ReadFile("../../test/podlist-status/redis.json")
+	require.NoError(s.T(), err, "ReadFile")
+
+	tests := []struct {
+		name        string
+		body        []byte
+		maxBodySize int64
+	}{
+		{name: "Invalid", body: []byte("k8s\x00invalid")},
+		{name: "Too large", body: body, maxBodySize: 100},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			cfg := s.service.cfg
+			cfg.UpstreamProtobuf = true
+			cfg.MaxBodySize = tc.maxBodySize
+			cfg.RequestTimeout = time.Minute
+			// same to http.Transport: the response refers to the request, which is canceled by its context
+			cfg.ProxyTransport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				if err := r.Context().Err(); err != nil {
+					return nil, err
+				}
+				if strings.Contains(r.Header.Get("Accept"), ContentTypeProtobuf) {
+					resp := newListResponse(r, tc.body, "")
+					resp.Header.Set("Content-Type", ContentTypeProtobuf)
+
+					return resp, nil
+				}
+
+				return newListResponse(r, jsonBody, ""), nil
+			})
+			s.setConfig(cfg)
+
+			gotBody, _ := s.getBody("/api/v1/namespaces/redis/pods", nil)
+			require.Contains(s.T(), string(gotBody), `"metadata"`, "JSON body")
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"reflect"
+	"sync/atomic"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// Reload applies the settings, which can be changed at runtime: the Pod columns and joins
+// (PodResources, PodMetrics, PodEvents), the column sets per kind, the AggregateTimeout, the Namespaces,
+// the StreamLists, the EnrichWorkers, the MaxBodySize, the pagination, the UpstreamProtobuf, the ETag,
+// the response cache, the retries (RequestTimeout, RetryMax, RetryBackoff, BreakerFailures, BreakerCooldown),
+// the EnrichmentWarnings, the EnrichmentStrict and the compression of the responses.
+// Other settings (TargetURL, ListenAddr, clusters, connection timeouts, Modifiers) need a restart,
+// so their changes are logged and ignored.
+// On error, the previous settings are kept.
+func (s *Service) Reload(cfg configs.Proxy) error {
+	if err := validateCompression(cfg); err != nil {
+		return err
+	}
+	kinds, modifiers, err := s.compileKinds(cfg.Kinds, s.cfg.Modifiers)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cfg.TargetURL != s.cfg.TargetURL {
+		s.log.Info("Config reload ignored, restart required", "TargetURL", cfg.TargetURL)
+	}
+	if cfg.ListenAddr != s.cfg.ListenAddr {
+		s.log.Info("Config reload ignored, restart required", "ListenAddr", cfg.ListenAddr)
+	}
+	if cfg.DialTimeout != s.cfg.DialTimeout || cfg.TLSHandshakeTimeout != s.cfg.TLSHandshakeTimeout ||
+		cfg.ResponseHeaderTimeout != s.cfg.ResponseHeaderTimeout {
+		s.log.Info("Config reload ignored, restart required", "DialTimeout", cfg.DialTimeout,
+			"TLSHandshakeTimeout", cfg.TLSHandshakeTimeout, "ResponseHeaderTimeout", cfg.ResponseHeaderTimeout)
+	}
+	if cfg.ClusterName != s.cfg.ClusterName || !reflect.DeepEqual(cfg.Clusters, s.cfg.Clusters) {
+		s.log.Info("Config reload ignored, restart required", "ClusterName", cfg.ClusterName, "Clusters", len(cfg.Clusters))
+	}
+
+	s.cfg.PodResources = cfg.PodResources
+	s.cfg.PodMetrics = cfg.PodMetrics
+	s.cfg.PodEvents = cfg.PodEvents
+	s.cfg.ColumnsFile = cfg.ColumnsFile
+	s.cfg.Kinds = cfg.Kinds
+	s.cfg.AggregateTimeout = cfg.AggregateTimeout
+	s.cfg.Namespaces = cfg.Namespaces
+	s.cfg.StreamLists = cfg.StreamLists
+	s.cfg.EnrichWorkers = cfg.EnrichWorkers
+	s.cfg.MaxBodySize = cfg.MaxBodySize
+	atomic.StoreInt64(&s.maxBody, cfg.MaxBodySize)
+	s.cfg.PageSize = cfg.PageSize
+	s.cfg.PaginateMaxItems = cfg.PaginateMaxItems
+	s.cfg.UpstreamProtobuf = cfg.UpstreamProtobuf
+	s.cfg.EnrichmentWarnings = cfg.EnrichmentWarnings
+	s.cfg.EnrichmentStrict = cfg.EnrichmentStrict
+	s.cfg.ETag = cfg.ETag
+	s.cfg.ETagAgeBucket = cfg.ETagAgeBucket
+	s.cfg.CacheTTL = cfg.CacheTTL
+	s.cfg.CacheMaxBytes = cfg.CacheMaxBytes
+	s.cfg.CacheMaxEntries = cfg.CacheMaxEntries
+	s.cfg.RequestTimeout = cfg.RequestTimeout
+	s.cfg.RetryMax = cfg.RetryMax
+	s.cfg.RetryBackoff = cfg.RetryBackoff
+	s.cfg.BreakerFailures = cfg.BreakerFailures
+	s.cfg.BreakerCooldown = cfg.BreakerCooldown
+	s.retry.Store(retryPolicyOf(s.cfg))
+	s.cache.resize(cfg.CacheMaxBytes, cfg.CacheMaxEntries)
+	s.cfg.Compression = cfg.Compression
+	s.cfg.CompressionMinSize = cfg.CompressionMinSize
+	s.cfg.CompressionLevel = cfg.CompressionLevel
+	s.kinds = kinds
+	s.modifiers = modifiers
+	s.etagSeed = etagSeedOf(s.cfg)
+
+	return nil
+}
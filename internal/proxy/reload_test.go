@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+func (s *ServiceTestSuite) TestService_Reload() {
+	kinds, err := configs.LoadKinds("../../test/configs/columns.yaml")
+	require.NoError(s.T(), err, "LoadKinds")
+
+	cfg := s.service.cfg
+	cfg.Kinds = kinds
+	cfg.PodResources = true
+	cfg.TargetURL = "http://127.0.0.1:8002"
+	require.NoError(s.T(), s.service.Reload(cfg), "Reload")
+	require.Equal(s.T(), "http://127.0.0.1:8001", s.service.cfg.TargetURL, "TargetURL needs restart")
+
+	kubectlMaps := s.getKubectlMapsByKey("/pod-status/Running2.json", url.Values{}, "columns")
+	require.Equal(s.T(), "Running", kubectlMaps["node-exporter-s6tbv"]["State"], "State")
+	require.Equal(s.T(), "Burstable", kubectlMaps["node-exporter-s6tbv"]["QoSClass"], "QoSClass")
+
+	cfg.Kinds = []configs.KindColumns{{Kind: "Unknown"}}
+	require.ErrorIs(s.T(), s.service.Reload(cfg), configs.ErrInvalidKindColumns, "Reload invalid")
+	kubectlMaps = s.getKubectlMapsByKey("/pod-status/Running2.json", url.Values{}, "columns")
+	require.Equal(s.T(), "Running", kubectlMaps["node-exporter-s6tbv"]["State"], "previous kinds kept")
+}
+
+func (s *ServiceTestSuite) TestService_ConfigReloadMetrics() {
+	successes := testutil.ToFloat64(configReloads.WithLabelValues(ReloadSuccess))
+	failures := testutil.ToFloat64(configReloads.WithLabelValues(ReloadFailure))
+
+	ObserveConfigReload(nil)
+	ObserveConfigReload(errors.New("test"))
+	ObserveConfigReload(nil)
+
+	require.Equal(s.T(), successes+2, testutil.ToFloat64(configReloads.WithLabelValues(ReloadSuccess)), "success")
+	require.Equal(s.T(), failures+1, testutil.ToFloat64(configReloads.WithLabelValues(ReloadFailure)), "failure")
+	require.Positive(s.T(), testutil.ToFloat64(configLastReloadSuccess), "last success")
+
+	client := HTTPClient{}
+	resp, err := client.Get(context.Background(),
+		&(url.URL{Scheme: "http", Host: s.service.cfg.ListenAddr, Path: MetricsPath}))
+	require.NoError(s.T(), err, "Get")
+	require.Equal(s.T(), http.StatusOK, resp.StatusCode, "StatusCode")
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(s.T(), err, "ReadAll resp.Body")
+	require.NoError(s.T(), resp.Body.Close(), "Close resp.Body")
+	require.Contains(s.T(), string(respBody), `kubeproxy_ext_config_reloads_total{result="failure"}`, "metrics")
+}
+
+// blockingModifier blocks the first modification, until it's released
+type blockingModifier struct {
+	traceModifier
+	once    sync.Once
+	started chan struct{}
+	release chan struct{}
+}
+
+func (m *blockingModifier) Modify(req *http.Request, item *unstructured.Unstructured) error {
+	m.once.Do(func() {
+		close(m.started)
+		<-m.release
+	})
+
+	return m.traceModifier.Modify(req, item)
+}
+
+func (s *ServiceTestSuite) TestService_Reload_DuringEnrichment() {
+	for _, streamLists := range []bool{false, true} {
+		modifier := &blockingModifier{
+			traceModifier: traceModifier{name: "blocking", scope: configs.ScopeAll},
+			started:       make(chan struct{}), release: make(chan struct{}),
+		}
+		s.setModifiers(modifier)
+		s.service.cfg.StreamLists = streamLists
+
+		done := make(chan error, 1)
+		go func() {
+			client := HTTPClient{}
+			resp, err := client.Get(context.Background(),
+				&(url.URL{Scheme: "http", Host: s.service.cfg.ListenAddr, Path: "/podlist-status/redis.json"}))
+			if err == nil {
+				_, err = io.ReadAll(resp.Body)
+				resp.Body.Close() // nolint:errcheck,gosec // read error is checked
+			}
+			done <- err
+		}()
+		<-modifier.started
+
+		reloaded := make(chan error, 1)
+		go func() {
+			reloaded <- s.service.Reload(s.service.config())
+		}()
+		var err error
+		blocked := false
+		select {
+		case err = <-reloaded:
+		case <-time.After(5 * time.Second):
+			blocked = true
+		}
+		close(modifier.release)
+		require.False(s.T(), blocked, "Reload is blocked by the enrichment, streamLists=%t", streamLists)
+		require.NoError(s.T(), err, "Reload")
+		require.NoError(s.T(), <-done, "Get")
+	}
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	resourcehelper "k8s.io/kubernetes/pkg/api/v1/resource"
+	api "k8s.io/kubernetes/pkg/apis/core"
+	"k8s.io/kubernetes/pkg/apis/core/helper/qos"
+)
+
+// podResource describes a summarized resource and the unit of its normalized value
+type podResource struct {
+	name v1.ResourceName
+	col  string
+	unit string
+}
+
+var podResources = []podResource{ // nolint:gochecknoglobals // constant
+	{name: v1.ResourceCPU, col: "CPU", unit: "Millicores"},
+	{name: v1.ResourceMemory, col: "Memory", unit: "Bytes"},
+	{name: v1.ResourceEphemeralStorage, col: "Ephemeral Storage", unit: "Bytes"},
+}
+
+// podResourceColumns computes the effective requests/limits (like `kubectl describe node`) and the QoS class.
+// The effective value is the max of the init containers and the sum of the containers, plus the overhead.
+func podResourceColumns(item *unstructured.Unstructured, pod *api.Pod) (map[string]interface{}, error) {
+	reqs, limits, err := podRequestsAndLimits(item)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{
+		FormatKubectlColumn("QoS Class"): string(qos.GetPodQOS(pod)),
+	}
+	for _, res := range podResources {
+		setResourceColumns(values, res, "Requests", reqs)
+		setResourceColumns(values, res, "Limits", limits)
+	}
+
+	return values, nil
+}
+
+func podRequestsAndLimits(item *unstructured.Unstructured) (v1.ResourceList, v1.ResourceList, error) {
+	v1Pod := &v1.Pod{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.UnstructuredContent(), v1Pod); err != nil {
+		return nil, nil, fmt.Errorf("fromunstructured v1 pod: %w", err)
+	}
+	reqs, limits := resourcehelper.PodRequestsAndLimits(v1Pod)
+
+	return reqs, limits, nil
+}
+
+// setResourceColumns sets the quantity and its normalized value. The normalized value of a missing quantity
+// is omitted (same to a missing column), so it's distinguished from an explicit zero by filtering and sorting.
+func setResourceColumns(values map[string]interface{}, res podResource, kind string, list v1.ResourceList) {
+	col := FormatKubectlColumn(res.col + " " + kind)
+	quantity, has := list[res.name]
+	if !has {
+		values[col] = "<none>"
+
+		return
+	}
+
+	values[col] = quantity.String()
+	if res.name == v1.ResourceCPU {
+		values[col+res.unit] = quantity.MilliValue()
+	} else {
+		values[col+res.unit] = quantity.Value()
+	}
+}
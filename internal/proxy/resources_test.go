@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+func (s *ServiceTestSuite) TestService_ModifyResponse_PodResources() {
+	s.service.cfg.PodResources = true
+	tests := []struct {
+		name     string
+		bodyFile string
+		want     map[string]interface{}
+	}{
+		{
+			name:     "BestEffort",
+			bodyFile: "/pod-status/Completed.json",
+			want: map[string]interface{}{
+				"QoSClass":                      "BestEffort",
+				"CPURequests":                   "<none>",
+				"CPURequestsMillicores":         nil,
+				"CPULimits":                     "<none>",
+				"CPULimitsMillicores":           nil,
+				"MemoryRequests":                "<none>",
+				"MemoryRequestsBytes":           nil,
+				"MemoryLimits":                  "<none>",
+				"MemoryLimitsBytes":             nil,
+				"EphemeralStorageRequests":      "<none>",
+				"EphemeralStorageRequestsBytes": nil,
+				"EphemeralStorageLimits":        "<none>",
+				"EphemeralStorageLimitsBytes":   nil,
+			},
+		},
+		{
+			name:     "Burstable sum of containers",
+			bodyFile: "/pod-status/Running3.json",
+			want: map[string]interface{}{
+				"QoSClass":                      "Burstable",
+				"CPURequests":                   "30m",
+				"CPURequestsMillicores":         int64(30),
+				"CPULimits":                     "60m",
+				"CPULimitsMillicores":           int64(60),
+				"MemoryRequests":                "60Mi",
+				"MemoryRequestsBytes":           int64(60 * 1024 * 1024),
+				"MemoryLimits":                  "120Mi",
+				"MemoryLimitsBytes":             int64(120 * 1024 * 1024),
+				"EphemeralStorageRequests":      "<none>",
+				"EphemeralStorageRequestsBytes": nil,
+				"EphemeralStorageLimits":        "<none>",
+				"EphemeralStorageLimitsBytes":   nil,
+			},
+		},
+		{
+			name:     "Burstable max of init containers",
+			bodyFile: "/pod-status/Terminating2.json",
+			want: map[string]interface{}{
+				"QoSClass":                      "Burstable",
+				"CPURequests":                   "100m",
+				"CPURequestsMillicores":         int64(100),
+				"CPULimits":                     "2",
+				"CPULimitsMillicores":           int64(2000),
+				"MemoryRequests":                "128Mi",
+				"MemoryRequestsBytes":           int64(128 * 1024 * 1024),
+				"MemoryLimits":                  "1Gi",
+				"MemoryLimitsBytes":             int64(1024 * 1024 * 1024),
+				"EphemeralStorageRequests":      "<none>",
+				"EphemeralStorageRequestsBytes": nil,
+				"EphemeralStorageLimits":        "<none>",
+				"EphemeralStorageLimitsBytes":   nil,
+			},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			body, err := os.ReadFile("../../test" + tc.bodyFile)
+			require.NoError(s.T(), err, "bodyFile")
+			resp := &http.Response{
+				Header:        http.Header{},
+				Body:          io.NopCloser(bytes.NewReader(body)),
+				ContentLength: int64(len(body)),
+			}
+			err = s.service.ModifyResponse(resp)
+			require.NoError(s.T(), err, "ModifyResponse")
+
+			respBody, err := io.ReadAll(resp.Body)
+			require.NoError(s.T(), err, "ReadAll resp.Body")
+			unstrObj := &unstructured.Unstructured{}
+			err = unstrObj.UnmarshalJSON(respBody)
+			require.NoError(s.T(), err, "UnmarshalJSON resp.Body")
+
+			kubectlMap, has, err := unstructured.NestedMap(unstrObj.UnstructuredContent(), configs.ObjectKeyKubectl)
+			require.NoError(s.T(), err, "ObjectKeyKubectl")
+			require.True(s.T(), has, "ObjectKeyKubectl")
+			for col, want := range tc.want {
+				if want == nil {
+					s.NotContains(kubectlMap, col, col)
+				} else {
+					s.EqualValues(want, kubectlMap[col], col)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// maxRetryAfter is the max accepted Retry-After, the response is returned instead of a longer wait
+const maxRetryAfter = 10 * time.Second
+
+// maxBackoffShift limits the exponential backoff to RetryBackoff * 2^maxBackoffShift
+const maxBackoffShift = 10
+
+var (
+	upstreamRetries = promauto.NewCounterVec(prometheus.CounterOpts{ // nolint:gochecknoglobals // registered once
+		Namespace: metricsNamespace,
+		Name:      "upstream_retries_total",
+		Help:      "Number of the retried upstream requests",
+	}, []string{"cluster"})
+	upstreamBreakerOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{ // nolint:gochecknoglobals // registered once
+		Namespace: metricsNamespace,
+		Name:      "upstream_breaker_open",
+		Help:      "State of the circuit breaker of the upstream (1: open, 0: closed)",
+	}, []string{"cluster"})
+)
+
+// retryPolicy is the runtime config of the retries, the circuit breaker and the request timeout
+type retryPolicy struct {
+	retryMax        int
+	retryBackoff    time.Duration
+	requestTimeout  time.Duration
+	breakerFailures int
+	breakerCooldown time.Duration
+}
+
+func retryPolicyOf(cfg configs.Proxy) *retryPolicy {
+	return &retryPolicy{
+		retryMax:        cfg.RetryMax,
+		retryBackoff:    cfg.RetryBackoff,
+		requestTimeout:  cfg.RequestTimeout,
+		breakerFailures: cfg.BreakerFailures,
+		breakerCooldown: cfg.BreakerCooldown,
+	}
+}
+
+// getRetryPolicy returns the retry policy, without locking mu (the additional requests are sent under mu)
+func (s *Service) getRetryPolicy() *retryPolicy {
+	return s.retry.Load().(*retryPolicy) // nolint:forcetypeassert // only retryPolicy
+}
+
+// isWatch returns true for the watch requests. The watch parameter is parsed as the API server does (1, t, true).
+func isWatch(r *http.Request) bool {
+	watch, _ := strconv.ParseBool(r.URL.Query().Get("watch"))
+
+	return watch || strings.Contains(r.URL.Path, "/watch/")
+}
+
+// circuitBreaker opens after breakerFailures consecutive failures. After the cooldown, one probe request
+// is allowed (half-open): its success closes the breaker, its failure opens it again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	name      string
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// allow returns true, if a request can be sent, or the remaining cooldown
+func (b *circuitBreaker) allow(policy *retryPolicy) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if policy.breakerFailures <= 0 || b.failures < policy.breakerFailures {
+		return true, 0
+	}
+	if wait := time.Until(b.openUntil); wait > 0 {
+		return false, wait
+	}
+	if b.probing {
+		return false, 0
+	}
+	b.probing = true
+
+	return true, 0
+}
+
+// abort releases the probe of a request, which was canceled by the client
+func (b *circuitBreaker) abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// record records the result of a request
+func (b *circuitBreaker) record(success bool, policy *retryPolicy) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if success {
+		if b.failures >= policy.breakerFailures && policy.breakerFailures > 0 {
+			upstreamBreakerOpen.WithLabelValues(b.name).Set(0)
+		}
+		b.failures = 0
+
+		return
+	}
+	b.failures++
+	if policy.breakerFailures > 0 && b.failures >= policy.breakerFailures {
+		b.openUntil = time.Now().Add(policy.breakerCooldown)
+		upstreamBreakerOpen.WithLabelValues(b.name).Set(1)
+	}
+}
+
+// retryTransport retries the idempotent requests on connection errors, 429 and 5xx responses
+// with jittered exponential backoff (or by Retry-After), limits the duration of the requests
+// and fails fast by the circuit breaker, if the upstream is down.
+type retryTransport struct {
+	next    http.RoundTripper
+	policy  func() *retryPolicy
+	breaker *circuitBreaker
+}
+
+func (t *retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	policy := t.policy()
+	parent := r.Context()
+	ctx, cancel := context.WithCancel(parent)
+	if policy.requestTimeout > 0 && !isWatch(r) {
+		ctx, cancel = context.WithTimeout(parent, policy.requestTimeout)
+	}
+	r = r.WithContext(ctx)
+	retries := 0
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		retries = policy.retryMax
+	}
+
+	for attempt := 0; ; attempt++ {
+		if allowed, wait := t.breaker.allow(policy); !allowed {
+			cancel()
+			seconds := int(wait.Seconds()) + 1
+			resp := newStatusResponse(r, newStatus(http.StatusServiceUnavailable, metav1.StatusReasonServiceUnavailable,
+				fmt.Sprintf("upstream %s is unavailable: circuit breaker open", t.breaker.name)))
+			resp.Header.Set("Retry-After", strconv.Itoa(seconds))
+
+			return resp, nil
+		}
+
+		resp, err := t.next.RoundTrip(r)
+		if err != nil && parent.Err() != nil {
+			t.breaker.abort()
+			cancel()
+
+			return nil, err // nolint:wrapcheck // canceled by the client
+		}
+		t.breaker.record(err == nil && !upstreamFailure(resp.StatusCode), policy)
+
+		wait, retry := retryWait(resp, err, policy.retryBackoff, attempt)
+		if !retry || attempt >= retries {
+			if err != nil {
+				cancel()
+
+				return nil, err // nolint:wrapcheck // transparent
+			}
+			resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+			// The request context is canceled by closing the body, the response handling (additional requests,
+			// see refetchJSON and joinItems) uses the context of the inbound request.
+			if resp.Request != nil {
+				resp.Request = resp.Request.WithContext(parent)
+			}
+
+			return resp, nil
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096)) // nolint:errcheck,gosec,gomnd // reuse connection
+			resp.Body.Close()                                    // nolint:errcheck,gosec // retried
+		}
+		upstreamRetries.WithLabelValues(t.breaker.name).Inc()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			cancel()
+
+			return nil, fmt.Errorf("retry: %w", ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// upstreamFailure returns true for the status codes, which mean the upstream is (temporary) down
+func upstreamFailure(statusCode int) bool {
+	return statusCode >= http.StatusInternalServerError && statusCode != http.StatusNotImplemented
+}
+
+// retryWait returns the wait before the next attempt and false, if the result shouldn't be retried.
+// The Retry-After header of 429 and 503 responses is respected, but max maxRetryAfter.
+func retryWait(resp *http.Response, err error, backoff time.Duration, attempt int) (time.Duration, bool) {
+	if err == nil && resp.StatusCode != http.StatusTooManyRequests && !upstreamFailure(resp.StatusCode) {
+		return 0, false
+	}
+	if err == nil {
+		if retryAfter, has := parseRetryAfter(resp.Header.Get("Retry-After")); has {
+			return retryAfter, retryAfter <= maxRetryAfter
+		}
+	}
+	if attempt > maxBackoffShift {
+		attempt = maxBackoffShift
+	}
+	maxWait := backoff << attempt
+	if maxWait <= 0 {
+		return 0, true
+	}
+
+	return time.Duration(rand.Int63n(int64(maxWait))) + 1, true // nolint:gosec // jitter
+}
+
+// parseRetryAfter parses the seconds or the HTTP date of a Retry-After header
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+
+		return wait, true
+	}
+
+	return 0, false
+}
+
+// cancelBody cancels the request context, when the body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+
+	return err // nolint:wrapcheck // transparent
+}
@@ -0,0 +1,181 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// sequenceTransport returns the results one after the other, the last one is repeated
+type sequenceTransport struct {
+	statusCodes []int
+	headers     []http.Header
+	calls       int
+}
+
+func (t *sequenceTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	i := t.calls
+	if i >= len(t.statusCodes) {
+		i = len(t.statusCodes) - 1
+	}
+	t.calls++
+	if t.statusCodes[i] == 0 {
+		return nil, errors.New("connection refused")
+	}
+	resp := newTestResponse(r, t.statusCodes[i], "{}")
+	if i < len(t.headers) && t.headers[i] != nil {
+		resp.Header = t.headers[i]
+	}
+
+	return resp, nil
+}
+
+func newRetryTransport(next http.RoundTripper, policy retryPolicy) *retryTransport {
+	return &retryTransport{
+		next: next, policy: func() *retryPolicy { return &policy }, breaker: &circuitBreaker{name: "test"},
+	}
+}
+
+func (s *ServiceTestSuite) roundTrip(transport http.RoundTripper, method string) (*http.Response, error) {
+	s.T().Helper()
+	req, err := http.NewRequestWithContext(context.Background(), method,
+		"http://127.0.0.1:8001/api/v1/pods", http.NoBody)
+	require.NoError(s.T(), err, "NewRequest")
+
+	return transport.RoundTrip(req) // nolint:wrapcheck // test
+}
+
+func (s *ServiceTestSuite) TestRetryTransport() {
+	tests := []struct {
+		name        string
+		method      string
+		statusCodes []int
+		headers     []http.Header
+		retryMax    int
+		wantStatus  int
+		wantErr     bool
+		wantCalls   int
+	}{
+		{name: "Success", statusCodes: []int{200}, retryMax: 2, wantStatus: 200, wantCalls: 1},
+		{name: "5xx", statusCodes: []int{503, 502, 200}, retryMax: 2, wantStatus: 200, wantCalls: 3},
+		{name: "Exhausted", statusCodes: []int{503, 503, 200}, retryMax: 1, wantStatus: 503, wantCalls: 2},
+		{name: "Connection error", statusCodes: []int{0, 200}, retryMax: 2, wantStatus: 200, wantCalls: 2},
+		{name: "Connection error exhausted", statusCodes: []int{0}, retryMax: 2, wantErr: true, wantCalls: 3},
+		{name: "Not found", statusCodes: []int{404, 200}, retryMax: 2, wantStatus: 404, wantCalls: 1},
+		{
+			name: "Not idempotent", method: http.MethodPost, statusCodes: []int{503, 200}, retryMax: 2,
+			wantStatus: 503, wantCalls: 1,
+		},
+		{
+			name: "Retry-After", statusCodes: []int{429, 200}, headers: []http.Header{{"Retry-After": []string{"0"}}},
+			retryMax: 2, wantStatus: 200, wantCalls: 2,
+		},
+		{
+			name: "Retry-After too long", statusCodes: []int{429, 200},
+			headers: []http.Header{{"Retry-After": []string{"3600"}}}, retryMax: 2, wantStatus: 429, wantCalls: 1,
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			next := &sequenceTransport{statusCodes: tc.statusCodes, headers: tc.headers}
+			transport := newRetryTransport(next, retryPolicy{retryMax: tc.retryMax, retryBackoff: time.Millisecond})
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			resp, err := s.roundTrip(transport, method)
+			if tc.wantErr {
+				require.Error(s.T(), err, "RoundTrip")
+			} else {
+				require.NoError(s.T(), err, "RoundTrip")
+				require.Equal(s.T(), tc.wantStatus, resp.StatusCode, "StatusCode")
+				require.NoError(s.T(), resp.Body.Close(), "Close")
+			}
+			require.Equal(s.T(), tc.wantCalls, next.calls, "calls")
+		})
+	}
+}
+
+func (s *ServiceTestSuite) TestRetryTransport_Breaker() {
+	next := &sequenceTransport{statusCodes: []int{0, 503, 200}}
+	transport := newRetryTransport(next, retryPolicy{breakerFailures: 2, breakerCooldown: 50 * time.Millisecond})
+
+	_, err := s.roundTrip(transport, http.MethodGet)
+	require.Error(s.T(), err, "connection error")
+	resp, err := s.roundTrip(transport, http.MethodGet)
+	require.NoError(s.T(), err, "503")
+	require.Equal(s.T(), http.StatusServiceUnavailable, resp.StatusCode, "503")
+
+	resp, err = s.roundTrip(transport, http.MethodGet)
+	require.NoError(s.T(), err, "open")
+	require.Equal(s.T(), 2, next.calls, "fail fast")
+	require.Equal(s.T(), http.StatusServiceUnavailable, resp.StatusCode, "open")
+	require.Equal(s.T(), "1", resp.Header.Get("Retry-After"), "Retry-After")
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(s.T(), err, "ReadAll")
+	status := metav1.Status{}
+	require.NoError(s.T(), json.Unmarshal(body, &status), "Unmarshal")
+	require.Equal(s.T(), "Status", status.Kind, "kind")
+	require.Equal(s.T(), metav1.StatusReasonServiceUnavailable, status.Reason, "reason")
+
+	time.Sleep(60 * time.Millisecond)
+	resp, err = s.roundTrip(transport, http.MethodGet)
+	require.NoError(s.T(), err, "probe")
+	require.Equal(s.T(), http.StatusOK, resp.StatusCode, "probe")
+	resp, err = s.roundTrip(transport, http.MethodGet)
+	require.NoError(s.T(), err, "closed")
+	require.Equal(s.T(), http.StatusOK, resp.StatusCode, "closed")
+	require.Equal(s.T(), 4, next.calls, "calls")
+}
+
+func (s *ServiceTestSuite) TestRetryTransport_Timeout() {
+	blocking := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		<-r.Context().Done()
+
+		return nil, r.Context().Err() // nolint:wrapcheck // OK
+	})
+	transport := newRetryTransport(blocking, retryPolicy{requestTimeout: 20 * time.Millisecond})
+	begin := time.Now()
+	_, err := s.roundTrip(transport, http.MethodGet)
+	require.ErrorIs(s.T(), err, context.DeadlineExceeded, "timeout")
+	require.Less(s.T(), time.Since(begin), time.Second, "duration")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := 0
+	canceled := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+
+		return nil, r.Context().Err() // nolint:wrapcheck // OK
+	})
+	transport = newRetryTransport(canceled, retryPolicy{retryMax: 2, breakerFailures: 1})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://127.0.0.1:8001/api/v1/pods", http.NoBody)
+	require.NoError(s.T(), err, "NewRequest")
+	_, err = transport.RoundTrip(req)
+	require.ErrorIs(s.T(), err, context.Canceled, "canceled by the client")
+	require.Equal(s.T(), 1, calls, "not retried")
+	allowed, _ := transport.breaker.allow(transport.policy())
+	require.True(s.T(), allowed, "not a failure")
+}
+
+func (s *ServiceTestSuite) TestParseRetryAfter() {
+	wait, has := parseRetryAfter("5")
+	require.True(s.T(), has, "seconds")
+	require.Equal(s.T(), 5*time.Second, wait, "seconds")
+
+	wait, has = parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	require.True(s.T(), has, "date")
+	require.Greater(s.T(), wait, 59*time.Minute, "date")
+
+	_, has = parseRetryAfter("")
+	require.False(s.T(), has, "empty")
+	_, has = parseRetryAfter("soon")
+	require.False(s.T(), has, "invalid")
+}
@@ -2,20 +2,21 @@ package proxy
 
 import (
 	"bytes"
-	"compress/flate"
-	"compress/gzip"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/go-logr/logr"
+	"golang.org/x/sync/singleflight"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/kubernetes/pkg/api/legacyscheme"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	api "k8s.io/kubernetes/pkg/apis/core"
 	"k8s.io/kubernetes/pkg/printers"
 	"k8s.io/kubernetes/pkg/printers/internalversion"
@@ -24,53 +25,76 @@ import (
 )
 
 type Service struct {
-	cfg            configs.Proxy
-	log            logr.Logger
-	proxy          *httputil.ReverseProxy
-	server         configs.HTTPServer
-	modifiers      map[string]func(item *unstructured.Unstructured) error
+	// mu guards the reloadable settings (cfg, modifiers, kinds), see Reload.
+	// It's held only for reading or replacing the settings, never during upstream requests or modifiers, see config.
+	mu     sync.RWMutex
+	cfg    configs.Proxy
+	log    logr.Logger
+	server configs.HTTPServer
+	// modifiers are the built-in and the additional modifiers, sorted by Order, see modifierOf
+	modifiers      []configs.Modifier
+	kinds          map[schema.GroupKind]*kindColumns
 	tableGenerator *printers.HumanReadableGenerator
+	// maxBody is the MaxBodySize, read atomically (also under mu)
+	maxBody int64
+	// cache is the response cache (CacheTTL), flight coalesces the concurrent identical requests
+	cache  *responseCache
+	flight singleflight.Group
+	// retry is the *retryPolicy, read atomically by the upstream transports
+	retry atomic.Value
+	// etagSeed is the hash of the enrichment settings in the ETag, see etagSeedOf
+	etagSeed    string
+	failedETags *failedETags
+
+	// defaultUpstream is the TargetURL, upstreams are the named clusters (including the default, if named)
+	defaultUpstream *upstream
+	upstreams       map[string]*upstream
 }
 
 // https://stackoverflow.com/questions/52986853/how-to-debug-httputil-newsinglehostreverseproxy
 
 func New(cfg configs.Proxy, log logr.Logger) (*Service, error) {
 	var err error
-	var targetURL *url.URL
-	if targetURL, err = url.Parse(cfg.TargetURL); err != nil {
-		return nil, fmt.Errorf("targeturl: %w", err)
-	}
-	proxy := httputil.NewSingleHostReverseProxy(targetURL)
-	proxyTransport := cfg.ProxyTransport
-	if proxyTransport == nil {
-		proxyTransport = &DebugTransport{log: log}
-	}
-	proxy.Transport = proxyTransport
-
-	server := cfg.HTTPServer
-	if server == nil {
-		server = &http.Server{
-			Addr:    cfg.ListenAddr,
-			Handler: proxy,
-		}
+	if err = validateCompression(cfg); err != nil {
+		return nil, err
 	}
 	service := &Service{
 		cfg:            cfg,
 		log:            log,
-		proxy:          proxy,
-		server:         server,
 		tableGenerator: printers.NewTableGenerator(),
+		maxBody:        cfg.MaxBodySize,
+		etagSeed:       etagSeedOf(cfg),
+		cache:          newResponseCache(cfg.CacheMaxBytes, cfg.CacheMaxEntries),
+		failedETags:    newFailedETags(),
 	}
-	proxy.ModifyResponse = service.ModifyResponse
-	service.modifiers = map[string]func(item *unstructured.Unstructured) error{
-		"Pod": service.modifyPod,
+	service.retry.Store(retryPolicyOf(cfg))
+	if err = service.newUpstreams(); err != nil {
+		return nil, err
+	}
+	service.server = cfg.HTTPServer
+	if service.server == nil {
+		service.server = &http.Server{
+			Addr:    cfg.ListenAddr,
+			Handler: service,
+		}
 	}
-
 	internalversion.AddHandlers(service.tableGenerator)
 
+	if service.kinds, service.modifiers, err = service.compileKinds(cfg.Kinds, cfg.Modifiers); err != nil {
+		return nil, err
+	}
+
 	return service, nil
 }
 
+// config returns a copy of the reloadable settings
+func (s *Service) config() configs.Proxy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.cfg
+}
+
 func (s *Service) Serve() {
 	err := s.server.ListenAndServe()
 	if !errors.Is(err, http.ErrServerClosed) {
@@ -78,119 +102,400 @@ func (s *Service) Serve() {
 	}
 }
 
+// ServeHTTP serves the own endpoints of the proxy, other requests are forwarded to the upstream (cluster).
+// The responses of the lists and the objects are cached, see serveCached.
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r, err := s.routeUpstream(r)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+
+		return
+	}
+
+	switch {
+	case r.URL.Path == MetricsPath:
+		metricsHandler.ServeHTTP(w, r)
+	case r.URL.Path == ClustersPath:
+		s.serveClusters(w, r)
+	default:
+		s.serveCached(w, r, s.serveResource)
+	}
+}
+
+// serveResource serves the own resource endpoints, other requests are forwarded to the upstream
+func (s *Service) serveResource(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == SummaryPath:
+		s.serveSummary(w, r)
+	case strings.HasPrefix(r.URL.Path, AggregatePathPrefix):
+		s.serveAggregate(w, r)
+	case strings.HasPrefix(r.URL.Path, NamespacesPathPrefix):
+		s.serveNamespaces(w, r)
+	case strings.HasPrefix(r.URL.Path, PaginatePathPrefix):
+		s.servePaginate(w, r)
+	default:
+		r, err := parseRequestOptions(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+
+			return
+		}
+		r = s.requestProtobuf(r)
+		s.upstreamOf(r).proxy.ServeHTTP(w, r)
+	}
+}
+
 var errBodyNotExtended = errors.New("body not extended")
 
+// ModifyResponse extends the response body. Lists are streamed item by item, if possible (see streamable),
+// other bodies are buffered. The watch events are rewritten one by one, see watchResponse.
+// Bodies larger than MaxBodySize or with unsupported Content-Encoding are forwarded untouched.
+// Protobuf bodies are converted to JSON, if the client accepts it, see protobufToJSON. Protobuf clients get
+// the body untouched, because the columns can't be represented in protobuf. If the protobuf body can't be sent
+// to the JSON client (not convertible or too large), it's requested again by the Accept of the client, see refetchJSON.
+// The extended body is compressed by the Accept-Encoding of the client, see compressBody.
+// The enriched responses without failed items get ETag, and 304 Not Modified is sent by If-None-Match,
+// see conditionalResponse.
+// The failed enrichment is marked by the EnrichmentHeader (and optionally by Warning), see failEnrichment,
+// the failed items of a list are annotated, see modifyItems. If the list options (for example: kubectlSelector)
+// can't be applied, a Status is sent instead of the list, see listErrorCode.
+// An error (for example: a corrupt compressed body) is sent as Status, see proxyErrorHandler.
 func (s *Service) ModifyResponse(resp *http.Response) error {
-	var reader io.ReadCloser
-	var err error
-	switch resp.Header.Get("Content-Encoding") {
-	case "gzip":
-		if reader, err = gzip.NewReader(resp.Body); err != nil {
-			return fmt.Errorf("resp body gzip: %w", err)
-		}
-		defer reader.Close() // nolint:errcheck // not important
-	case "deflate":
-		reader = flate.NewReader(resp.Body)
-		defer reader.Close() // nolint:errcheck // not important
-	default:
-		reader = resp.Body
+	if encodings, err := contentEncodings(resp.Header); err != nil {
+		s.skipEnrichment(resp, SkipUnsupportedEncoding, "encodings", encodings)
+
+		return nil
+	}
+	protobufBody := isProtobuf(resp.Header.Get("Content-Type"))
+	if protobufBody && !acceptsJSON(clientAccept(resp.Request)) {
+		s.skipEnrichment(resp, SkipProtobufClient)
+
+		return nil
+	}
+	if resp.Request != nil && isWatch(resp.Request) {
+		return s.watchResponse(resp)
+	}
+	limit := s.maxBodySize()
+	if limit > 0 && resp.ContentLength > limit {
+		if protobufBody {
+			if refetched, err := s.refetchJSON(resp); refetched {
+				return err
+			}
+		}
+		s.skipEnrichment(resp, SkipBodyTooLarge, "size", resp.ContentLength, "max", limit)
+
+		return nil
+	}
+	if s.streamable(resp) {
+		reader, err := decodeBody(resp)
+		if err != nil {
+			return err
+		}
+		return s.streamResponse(resp, reader, limit)
+	}
+
+	// The read part of a compressed body is recorded, so it can be forwarded untouched, if it's too large.
+	original := resp.Body
+	raw := &bytes.Buffer{}
+	encoded := len(resp.Header.Values("Content-Encoding")) > 0
+	if limit > 0 && encoded {
+		resp.Body = &replayBody{Reader: io.TeeReader(original, raw), Closer: original}
 	}
-	body, err := io.ReadAll(reader)
+	reader, err := decodeBody(resp)
 	if err != nil {
 		return err
 	}
-	if err = resp.Body.Close(); err != nil {
+	body, err := readLimited(reader, limit)
+	if errors.Is(err, configs.ErrBodyTooLarge) {
+		if protobufBody {
+			resp.Body = original
+			if refetched, err := s.refetchJSON(resp); refetched {
+				return err
+			}
+		}
+		if encoded {
+			resp.Body = newReplayBody(raw.Bytes(), original)
+		} else {
+			resp.Body = newReplayBody(body, original)
+		}
+		s.skipEnrichment(resp, SkipBodyTooLarge, "max", limit)
+
+		return nil
+	} else if err != nil {
+		reader.Close() // nolint:errcheck,gosec // read error is returned
+
+		return err
+	}
+	if err = reader.Close(); err != nil {
 		return fmt.Errorf("resp body close: %w", err)
 	}
 
+	if protobufBody {
+		jsonBody, err := protobufToJSON(body)
+		if err != nil {
+			resp.Body = original
+			if refetched, err := s.refetchJSON(resp); refetched {
+				return err
+			}
+			s.failEnrichment(resp, err)
+			resp.Header.Del("Content-Encoding")
+			setBody(resp, body)
+
+			return nil
+		}
+		body = jsonBody
+		resp.Header.Set("Content-Type", "application/json")
+	}
+
+	return s.extendResponse(resp, body)
+}
+
+// extendResponse replaces the buffered (decoded) body of the response by the extended body.
+// The ETag is set only after a successful enrichment.
+func (s *Service) extendResponse(resp *http.Response, body []byte) error {
 	newBody := body
-	if xBody, err := s.extendBody(body); err != nil {
-		if !errors.Is(err, errBodyNotExtended) {
-			s.log.Error(err, "ModifyResponse")
+	xBody, failures, err := s.extendBody(resp.Request, body, resp.Header)
+	if err != nil {
+		switch {
+		case errors.Is(err, errBodyNotExtended):
+		case getRequestOptions(resp.Request).listOptions():
+			s.log.Error(err, "ModifyResponse", "url", resp.Request.URL.String())
+			setStatusResponse(resp, listErrorCode(err), err.Error())
+
+			return nil
+		default:
+			s.failEnrichment(resp, err)
 		}
 	} else {
 		newBody = xBody
+		s.warnFailures(resp.Header, failures)
+		if failures == nil && s.conditionalResponse(resp, bodyResourceVersion(body)) {
+			return nil
+		}
 	}
 
-	respBody := io.NopCloser(bytes.NewReader(newBody))
-	resp.Body = respBody
-	resp.ContentLength = int64(len(newBody))
-	resp.Header.Set("Content-Length", strconv.Itoa(len(newBody)))
 	resp.Header.Del("Content-Encoding")
+	setBody(resp, s.compressBody(resp, newBody))
 
 	return nil
 }
 
+// setBody replaces the body of the response
+func setBody(resp *http.Response, body []byte) {
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+}
+
 // curl desktop:8003/api/v1/namespaces/kubernetes-dashboard/pods/dashboard-metrics-scraper-c45b7869d-lpdt2
 // curl desktop:8003/api/v1/namespaces/kubernetes-dashboard/pods
 
-func (s *Service) extendBody(body []byte) ([]byte, error) {
+// extendBody extends a list or an object. The failed items of a list are returned, see modifyItems.
+// The header gets the RemainingItemsHeader, see limitItems.
+func (s *Service) extendBody(req *http.Request, body []byte, header http.Header) ([]byte, *enrichFailures, error) {
+	opts := getRequestOptions(req)
+	cluster := s.upstreamOf(req).name
 	unstrList := &unstructured.UnstructuredList{}
 	unstrObj := &unstructured.Unstructured{}
 
 	if err := unstrList.UnmarshalJSON(body); err == nil && len(unstrList.Items) > 0 {
-		if modifier, has := s.modifiers[unstrList.Items[0].GetKind()]; has {
-			for i := range unstrList.Items {
-				item := &unstrList.Items[i]
-				if err := modifier(item); err != nil {
-					return body, fmt.Errorf("modify %s: %w", item.GetKind(), err)
-				}
-			}
-			if bodyOK, err := unstrList.MarshalJSON(); err != nil {
-				return body, fmt.Errorf("marshalljson podlist: %w", err)
-			} else {
-				return bodyOK, nil
-			}
+		if enriched, failures, err := s.enrichList(req, unstrList, opts, cluster); err != nil {
+			return body, nil, err
+		} else if enriched || opts.listOptions() {
+			bodyOK, err := s.finishList(unstrList, opts, header)
+
+			return bodyOK, failures, err
 		}
 	} else if err := unstrObj.UnmarshalJSON(body); err == nil {
-		if modifier, has := s.modifiers[unstrObj.GetKind()]; has {
-			if err := modifier(unstrObj); err != nil {
-				return body, fmt.Errorf("modify %s: %w", unstrObj.GetKind(), err)
+		if unstrObj.IsList() {
+			if opts.output == KubectlOutputColumns {
+				bodyOK, err := marshalCustomColumns(nil, opts.columns, true, configs.ObjectKeyKubectl)
+
+				return bodyOK, nil, err
+			}
+		} else if modifier, has := s.modifierOf(req, unstrObj.GroupVersionKind(), configs.ScopeObject); has ||
+			opts.anyKind() {
+			if err := s.modifyItem(modifier, unstrObj, opts, cluster); err != nil {
+				return body, nil, err
 			}
+			if has {
+				s.joinItems(req, []*unstructured.Unstructured{unstrObj}, false)
+			}
+
+			if opts.output == KubectlOutputColumns {
+				bodyOK, err := marshalCustomColumns([]unstructured.Unstructured{*unstrObj}, opts.columns, false,
+					s.kindColumnsOf(unstrObj.GroupVersionKind().GroupKind()).key)
 
+				return bodyOK, nil, err
+			}
 			if bodyOK, err := unstrObj.MarshalJSON(); err != nil {
-				return body, fmt.Errorf("marshalljson pod: %w", err)
+				return body, nil, fmt.Errorf("marshalljson pod: %w", err)
 			} else {
-				return bodyOK, nil
+				return bodyOK, nil, nil
 			}
 		}
 	}
 
-	return body, errBodyNotExtended
+	return body, nil, errBodyNotExtended
 }
 
-func (s *Service) modifyPod(item *unstructured.Unstructured) error {
-	pod := &api.Pod{}
-	if err := legacyscheme.Scheme.Convert(item, pod, item.GroupVersionKind()); err != nil {
-		return fmt.Errorf("fromunstructured pod: %w", err)
+// modifyItem runs the modifier (can be nil) and adds the custom columns
+func (s *Service) modifyItem(modifier func(item *unstructured.Unstructured) error, item *unstructured.Unstructured,
+	opts *requestOptions, cluster string,
+) error {
+	if modifier != nil {
+		if err := modifier(item); err != nil {
+			return fmt.Errorf("modify %s: %w", item.GetKind(), err)
+		}
+	}
+	if len(opts.columns) > 0 {
+		if err := s.addCustomColumns(item, opts.columns); err != nil {
+			return fmt.Errorf("columns %s: %w", item.GetKind(), err)
+		}
+	}
+	if cluster != "" {
+		if err := s.addKubectlValues(item, map[string]interface{}{ClusterColumn: cluster}); err != nil {
+			return fmt.Errorf("cluster %s: %w", item.GetKind(), err)
+		}
+	}
+
+	return nil
+}
+
+// enrichList modifies and joins the items of a list. Returns false, if there is nothing to do.
+// The failed items are returned, see modifyItems.
+func (s *Service) enrichList(req *http.Request, unstrList *unstructured.UnstructuredList, opts *requestOptions,
+	cluster string,
+) (bool, *enrichFailures, error) {
+	modifier, has := s.modifierOf(req, unstrList.Items[0].GroupVersionKind(), configs.ScopeList)
+	if !has && !opts.anyKind() {
+		return false, nil, nil
 	}
 
-	table, err := s.tableGenerator.GenerateTable(pod, printers.GenerateOptions{NoHeaders: false, Wide: true})
+	items := make([]*unstructured.Unstructured, 0, len(unstrList.Items))
+	for i := range unstrList.Items {
+		items = append(items, &unstrList.Items[i])
+	}
+	failures, err := s.modifyItems(modifier, items, opts, cluster)
 	if err != nil {
-		return fmt.Errorf("generatetable: %w", err)
+		return false, nil, err
+	}
+	if has {
+		s.joinItems(req, items, true)
+	}
+
+	return true, failures, nil
+}
+
+// finishList filters, sorts and limits the items of an enriched list,
+// and returns the list or only the custom columns.
+// The items of a kind without modifier have no kubectl columns, so they can't be filtered or sorted
+// (ErrUnsupportedKubectlKind), except by the custom columns.
+func (s *Service) finishList(unstrList *unstructured.UnstructuredList, opts *requestOptions, header http.Header,
+) ([]byte, error) {
+	key := configs.ObjectKeyKubectl
+	if len(unstrList.Items) > 0 {
+		item := &unstrList.Items[0]
+		key = s.kindColumnsOf(item.GroupVersionKind().GroupKind()).key
+		if (len(opts.selector) > 0 || len(opts.sortBy) > 0) && !opts.anyKind() {
+			if _, has := s.modifierOf(nil, item.GroupVersionKind(), configs.ScopeList); !has {
+				return nil, fmt.Errorf("%w: %s", configs.ErrUnsupportedKubectlKind, item.GetKind())
+			}
+		}
 	}
-	if len(table.Rows) < 1 {
-		return configs.ErrGenerateTableNoRow
+	if len(opts.selector) > 0 {
+		unstrList.Items = filterItems(unstrList.Items, opts.selector, key)
 	}
-	if len(table.Rows) > 1 {
-		return configs.ErrGenerateTableMoreRows
+	if len(opts.sortBy) > 0 {
+		sortItems(unstrList.Items, opts.sortBy, key)
 	}
+	limitItems(unstrList, opts.limit, header)
 
-	values := map[string]interface{}{}
-	conditions := []string{}
-	for _, condition := range table.Rows[0].Conditions {
-		conditions = append(conditions, fmt.Sprintf("%s, %s", condition.Reason, condition.Message))
+	if opts.output == KubectlOutputColumns {
+		return marshalCustomColumns(unstrList.Items, opts.columns, true, key)
 	}
-	if len(conditions) == 0 {
-		values[FormatKubectlColumn("Conditions")] = "<none>"
-	} else {
-		values[FormatKubectlColumn("Conditions")] = strings.Join(conditions, "; ")
+	bodyOK, err := unstrList.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("marshalljson podlist: %w", err)
+	}
+
+	return bodyOK, nil
+}
+
+// joinItems adds information from other resources to the already modified items.
+// The items have the same kind. The request can be nil.
+func (s *Service) joinItems(req *http.Request, items []*unstructured.Unstructured, isList bool) {
+	ctx := context.Background()
+	if req != nil {
+		ctx = req.Context()
+	}
+
+	cfg := s.config()
+	if items[0].GetKind() == "Pod" && cfg.PodMetrics {
+		s.joinPodMetrics(ctx, req, items, isList)
+	}
+	if items[0].GetKind() == "Pod" && cfg.PodEvents {
+		s.joinPodEvents(ctx, req, items, isList)
+	}
+}
+
+func (s *Service) modifyPod(item *unstructured.Unstructured) error {
+	kc := s.kindColumnsOf(podGroupKind)
+	obj, table, err := s.generateTable(item, kc)
+	if err != nil {
+		return err
+	}
+	pod, is := obj.(*api.Pod)
+	if !is {
+		return fmt.Errorf("%w: %T", configs.ErrInvalidKindColumns, obj)
+	}
+
+	values := kc.printerValues(table)
+	if name, keep := kc.columnName(conditionsColumn); keep {
+		conditions := []string{}
+		for _, condition := range table.Rows[0].Conditions {
+			conditions = append(conditions, fmt.Sprintf("%s, %s", condition.Reason, condition.Message))
+		}
+		if len(conditions) == 0 {
+			values[name] = "<none>"
+		} else {
+			values[name] = strings.Join(conditions, "; ")
+		}
 	}
-	for c, column := range table.ColumnDefinitions {
-		values[FormatKubectlColumn(column.Name)] = table.Rows[0].Cells[c]
+	if s.config().PodResources {
+		resourceValues, err := podResourceColumns(item, pod)
+		if err != nil {
+			return err
+		}
+		for col, value := range resourceValues {
+			values[col] = value
+		}
+	}
+	if err := kc.addJSONPathValues(item, values); err != nil {
+		return err
 	}
 
-	if err := unstructured.SetNestedMap(item.UnstructuredContent(), values, configs.ObjectKeyKubectl); err != nil {
+	if err := unstructured.SetNestedMap(item.UnstructuredContent(), values, kc.key); err != nil {
+		return fmt.Errorf("setnestedstringmap: %w", err)
+	}
+
+	return nil
+}
+
+// addKubectlValues merges the values into the kubectl columns (the key of the kind) of an already modified item
+func (s *Service) addKubectlValues(item *unstructured.Unstructured, values map[string]interface{}) error {
+	key := s.kindColumnsOf(item.GroupVersionKind().GroupKind()).key
+	kubectlMap, _, err := unstructured.NestedMap(item.UnstructuredContent(), key)
+	if err != nil {
+		return fmt.Errorf("nestedmap: %w", err)
+	}
+	if kubectlMap == nil {
+		kubectlMap = map[string]interface{}{}
+	}
+	for col, value := range values {
+		kubectlMap[col] = value
+	}
+	if err := unstructured.SetNestedMap(item.UnstructuredContent(), kubectlMap, key); err != nil {
 		return fmt.Errorf("setnestedstringmap: %w", err)
 	}
 
@@ -203,6 +508,8 @@ func FormatKubectlColumn(col string) string {
 
 type DebugTransport struct {
 	log logr.Logger
+	// transport is the next transport, default: http.DefaultTransport
+	transport http.RoundTripper
 }
 
 func (d *DebugTransport) RoundTrip(r *http.Request) (*http.Response, error) {
@@ -212,5 +519,9 @@ func (d *DebugTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 	}
 	d.log.Info(string(b))
 
+	if d.transport != nil {
+		return d.transport.RoundTrip(r) // nolint:wrapcheck // OK
+	}
+
 	return http.DefaultTransport.RoundTrip(r) // nolint:wrapcheck // OK
 }
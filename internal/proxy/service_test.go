@@ -13,8 +13,11 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -49,10 +52,40 @@ func (ts *TestServer) Shutdown(ctx context.Context) error {
 
 type TestTransport struct {
 	fileTransport http.RoundTripper
+	mu            sync.Mutex
+	lastURL       *url.URL
+}
+
+// testAliases maps the upstream API paths to test files
+var testAliases = map[string]string{ // nolint:gochecknoglobals // constant
+	"/api/v1/pods":                  "/podlist-status/mongo.json",
+	"/api/v1/namespaces/redis/pods": "/podlist-status/redis.json",
+	"/api/v1/namespaces/mongo/pods": "/podlist-status/mongo.json",
 }
 
 func (t *TestTransport) RoundTrip(r *http.Request) (*http.Response, error) {
-	return t.fileTransport.RoundTrip(r) // nolint:wrapcheck // OK
+	t.mu.Lock()
+	t.lastURL = r.URL
+	t.mu.Unlock()
+	fileReq := r
+	if alias, has := testAliases[r.URL.Path]; has {
+		fileReq = r.Clone(r.Context())
+		fileReq.URL.Path = alias
+	}
+	resp, err := t.fileTransport.RoundTrip(fileReq)
+	if resp != nil {
+		resp.Request = r
+	}
+
+	return resp, err // nolint:wrapcheck // OK
+}
+
+// getLastURL returns the URL of the last request
+func (t *TestTransport) getLastURL() *url.URL {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.lastURL
 }
 
 func (s *ServiceTestSuite) SetupTest() {
@@ -65,11 +98,23 @@ func (s *ServiceTestSuite) SetupTest() {
 		ListenAddr: testServer.server.Listener.Addr().String(),
 
 		HTTPServer:     testServer,
-		ProxyTransport: &TestTransport{http.NewFileTransport(http.Dir("../../test/"))},
+		ProxyTransport: &TestTransport{fileTransport: http.NewFileTransport(http.Dir("../../test/"))},
 	}, logger.New().Logger)
 	require.NoError(s.T(), err, "SetupTest")
 
-	testServer.server.Config.Handler = s.service.proxy
+	testServer.server.Config.Handler = s.service
+}
+
+// setConfig replaces the service by a new one with the config
+func (s *ServiceTestSuite) setConfig(cfg configs.Proxy) {
+	s.T().Helper()
+	service, err := New(cfg, s.service.log)
+	require.NoError(s.T(), err, "New")
+
+	testServer, is := s.service.server.(*TestServer)
+	require.True(s.T(), is, "TestServer")
+	testServer.server.Config.Handler = service
+	s.service = service
 }
 
 func (s *ServiceTestSuite) TearDownTest() {
@@ -89,6 +134,43 @@ func (c *HTTPClient) Get(ctx context.Context, reqURL fmt.Stringer) (*http.Respon
 	return c.Do(req)
 }
 
+// getKubectlMaps GETs a Pod or a list by the proxy and returns the kubectl columns by Pod name
+func (s *ServiceTestSuite) getKubectlMaps(reqPath string, query url.Values) map[string]map[string]interface{} {
+	s.T().Helper()
+
+	return s.getKubectlMapsByKey(reqPath, query, configs.ObjectKeyKubectl)
+}
+
+// getKubectlMapsByKey GETs an object or a list by the proxy and returns the columns under the key by name
+func (s *ServiceTestSuite) getKubectlMapsByKey(reqPath string, query url.Values, key string,
+) map[string]map[string]interface{} {
+	s.T().Helper()
+	client := HTTPClient{}
+	resp, err := client.Get(context.Background(),
+		&(url.URL{Scheme: "http", Host: s.service.cfg.ListenAddr, Path: reqPath, RawQuery: query.Encode()}))
+	require.NoError(s.T(), err, "Get")
+	require.Equal(s.T(), http.StatusOK, resp.StatusCode, "StatusCode")
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(s.T(), err, "ReadAll resp.Body")
+	require.NoError(s.T(), resp.Body.Close(), "Close resp.Body")
+
+	unstrList := &unstructured.UnstructuredList{}
+	if err := unstrList.UnmarshalJSON(respBody); err != nil || unstrList.GetKind() == "Pod" {
+		unstrObj := &unstructured.Unstructured{}
+		require.NoError(s.T(), unstrObj.UnmarshalJSON(respBody), "UnmarshalJSON resp.Body")
+		unstrList.Items = []unstructured.Unstructured{*unstrObj}
+	}
+
+	kubectlMaps := map[string]map[string]interface{}{}
+	for _, item := range unstrList.Items {
+		kubectlMap, _, err := unstructured.NestedMap(item.UnstructuredContent(), key)
+		require.NoError(s.T(), err, key)
+		kubectlMaps[item.GetName()] = kubectlMap
+	}
+
+	return kubectlMaps
+}
+
 func (s *ServiceTestSuite) TestService_Proxy_Pod() {
 	tests := s.getPodTests()
 	for _, tc := range tests {
@@ -117,6 +199,18 @@ func (s *ServiceTestSuite) TestService_ModifyResponse_Pod_Deflate() {
 	s.testServiceModifyResponsePod("deflate")
 }
 
+func (s *ServiceTestSuite) TestService_ModifyResponse_Pod_Brotli() {
+	s.testServiceModifyResponsePod("br")
+}
+
+func (s *ServiceTestSuite) TestService_ModifyResponse_Pod_Zstd() {
+	s.testServiceModifyResponsePod("zstd")
+}
+
+func (s *ServiceTestSuite) TestService_ModifyResponse_Pod_Stacked() {
+	s.testServiceModifyResponsePod("gzip, br")
+}
+
 func (s *ServiceTestSuite) testServiceModifyResponsePod(contentEncoding string) {
 	tests := s.getPodTests()
 	for _, tc := range tests {
@@ -145,6 +239,38 @@ func (s *ServiceTestSuite) testServiceModifyResponsePod(contentEncoding string)
 				s.NoError(err, "flate Close")
 				body = buf.Bytes()
 				headers.Set("Content-Encoding", contentEncoding)
+			case "br":
+				buf := bytes.Buffer{}
+				writer := brotli.NewWriter(&buf)
+				_, err := writer.Write(body)
+				s.NoError(err, "brotli Write")
+				err = writer.Close()
+				s.NoError(err, "brotli Close")
+				body = buf.Bytes()
+				headers.Set("Content-Encoding", contentEncoding)
+			case "zstd":
+				buf := bytes.Buffer{}
+				writer, err := zstd.NewWriter(&buf)
+				s.NoError(err, "zstd NewWriter")
+				_, err = writer.Write(body)
+				s.NoError(err, "zstd Write")
+				err = writer.Close()
+				s.NoError(err, "zstd Close")
+				body = buf.Bytes()
+				headers.Set("Content-Encoding", contentEncoding)
+			case "gzip, br":
+				gzipBuf := bytes.Buffer{}
+				gzipWriter := gzip.NewWriter(&gzipBuf)
+				_, err := gzipWriter.Write(body)
+				s.NoError(err, "gzip Write")
+				s.NoError(gzipWriter.Close(), "gzip Close")
+				buf := bytes.Buffer{}
+				writer := brotli.NewWriter(&buf)
+				_, err = writer.Write(gzipBuf.Bytes())
+				s.NoError(err, "brotli Write")
+				s.NoError(writer.Close(), "brotli Close")
+				body = buf.Bytes()
+				headers.Set("Content-Encoding", contentEncoding)
 			}
 			resp := &http.Response{
 				Proto:         "HTTP/1.0",
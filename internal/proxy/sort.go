@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// Query parameters for sorting and truncating list items by the kubectl columns, for example:
+// curl '127.0.0.1:8003/api/v1/pods?kubectlSortBy=-Restarts&kubectlLimit=10'
+const (
+	KubectlSortByParam = "kubectlSortBy"
+	KubectlLimitParam  = "kubectlLimit"
+)
+
+// RemainingItemsHeader is the number of the items dropped by kubectlLimit.
+// The remainingItemCount of the list metadata is increased by the same number, see limitItems.
+const RemainingItemsHeader = "X-Kubeproxy-Remaining-Items"
+
+// kubectlSortKey is a kubectl column, the descending order is marked by '-' prefix
+type kubectlSortKey struct {
+	column     string
+	descending bool
+}
+
+func parseKubectlSortBy(text string) ([]kubectlSortKey, error) {
+	sortBy := []kubectlSortKey{}
+	for _, column := range strings.Split(text, ",") {
+		column = strings.TrimSpace(column)
+		key := kubectlSortKey{column: strings.TrimPrefix(column, "-"), descending: strings.HasPrefix(column, "-")}
+		if key.column == "" {
+			return nil, fmt.Errorf("%w: %s", configs.ErrInvalidKubectlSortBy, text)
+		}
+		sortBy = append(sortBy, key)
+	}
+
+	return sortBy, nil
+}
+
+// sortItems sorts the already modified items by the kubectl columns, see sortValue.
+// The original order of equal items is kept.
+func sortItems(items []unstructured.Unstructured, sortBy []kubectlSortKey, key string) {
+	values := make([][]sortValue, len(items))
+	for i := range items {
+		row, _, _ := unstructured.NestedMap(items[i].UnstructuredContent(), key)
+		values[i] = make([]sortValue, len(sortBy))
+		for k, sortKey := range sortBy {
+			values[i][k] = newSortValue(row[sortKey.column])
+		}
+	}
+
+	sort.Stable(&itemSorter{items: items, values: values, sortBy: sortBy})
+}
+
+// Ranks of the sort values
+const (
+	sortRankMissing = iota
+	sortRankNumber
+	sortRankText
+)
+
+// sortValue is a kubectl column value of an item. The values are totally ordered: missing columns,
+// then numbers, ratios and kubectl durations by value (same to compareKubectlValues), then other values as text.
+type sortValue struct {
+	rank   int
+	number float64
+	text   string
+}
+
+func newSortValue(value interface{}) sortValue {
+	if value == nil {
+		return sortValue{rank: sortRankMissing}
+	}
+	text := fmt.Sprintf("%v", value)
+	if number, ok := parseKubectlNumber(text); ok {
+		return sortValue{rank: sortRankNumber, number: number}
+	}
+	if duration, ok := parseKubectlDuration(text); ok {
+		return sortValue{rank: sortRankNumber, number: float64(duration)}
+	}
+
+	return sortValue{rank: sortRankText, text: text}
+}
+
+func (v sortValue) compare(other sortValue) int {
+	switch {
+	case v.rank != other.rank:
+		return compareFloats(float64(v.rank), float64(other.rank))
+	case v.rank == sortRankNumber:
+		return compareFloats(v.number, other.number)
+	default:
+		return strings.Compare(v.text, other.text)
+	}
+}
+
+type itemSorter struct {
+	items  []unstructured.Unstructured
+	values [][]sortValue
+	sortBy []kubectlSortKey
+}
+
+func (is *itemSorter) Len() int {
+	return len(is.items)
+}
+
+func (is *itemSorter) Swap(i, j int) {
+	is.items[i], is.items[j] = is.items[j], is.items[i]
+	is.values[i], is.values[j] = is.values[j], is.values[i]
+}
+
+func (is *itemSorter) Less(i, j int) bool {
+	for k, key := range is.sortBy {
+		cmp := is.values[i][k].compare(is.values[j][k])
+		if cmp == 0 {
+			continue
+		}
+		if key.descending {
+			return cmp > 0
+		}
+
+		return cmp < 0
+	}
+
+	return false
+}
+
+// limitItems truncates the list and sets the number of the dropped items in the RemainingItemsHeader.
+// The dropped items are added to the remainingItemCount of the list (the items after the upstream page).
+func limitItems(list *unstructured.UnstructuredList, limit int, header http.Header) {
+	if limit < 1 || len(list.Items) <= limit {
+		return
+	}
+
+	dropped := int64(len(list.Items) - limit)
+	remaining := dropped
+	if upstream := list.GetRemainingItemCount(); upstream != nil {
+		remaining += *upstream
+	}
+	list.SetRemainingItemCount(&remaining)
+	header.Set(RemainingItemsHeader, strconv.FormatInt(dropped, 10))
+	list.Items = list.Items[:limit]
+}
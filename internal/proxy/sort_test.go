@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func (s *ServiceTestSuite) TestService_Proxy_KubectlSortBy() {
+	tests := []struct {
+		name          string
+		bodyFile      string
+		query         url.Values
+		want          []string
+		wantRemaining string
+	}{
+		{
+			name:     "Top restarts",
+			bodyFile: "/podlist-status/longhorn-system.json",
+			query:    url.Values{KubectlSortByParam: {"-Restarts"}, KubectlLimitParam: {"4"}},
+			want: []string{
+				"longhorn-csi-plugin-hzlbr", "longhorn-csi-plugin-npxkc",
+				"longhorn-csi-plugin-nw2lv", "longhorn-ui-9fdb94f9-w84gf",
+			},
+			wantRemaining: "25",
+		},
+		{
+			name:     "Multiple columns",
+			bodyFile: "/podlist-status/redis.json",
+			query:    url.Values{KubectlSortByParam: {"Ready,-Name"}},
+			want: []string{
+				"redisoperator-56d6888cc-ks84t", "rfs-vcc-5cc6bf796c-mmrkr", "rfs-vcc-5cc6bf796c-g9mnr",
+				"rfr-vcc-1", "rfr-vcc-0",
+			},
+		},
+		{
+			name:     "Filtered",
+			bodyFile: "/podlist-status/redis.json",
+			query: url.Values{
+				KubectlSelectorParam: {"Status=Running"}, KubectlSortByParam: {"Node"}, KubectlLimitParam: {"2"},
+			},
+			want:          []string{"rfr-vcc-0", "rfs-vcc-5cc6bf796c-g9mnr"},
+			wantRemaining: "2",
+		},
+		{
+			name:     "Limit over items",
+			bodyFile: "/podlist-status/mongo.json",
+			query:    url.Values{KubectlLimitParam: {"10"}},
+			want: []string{
+				"mongodb-exporter-prometheus-mongodb-exporter-6dcdd8c8fc-zqffr",
+				"mongodb-exporter-prometheus-mongodb-exporter-test-connection",
+				"percona-server-mongodb-operator-fcc5c8d6-sqb8m", "vcc-rs0-0", "vcc-rs0-1",
+			},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			client := HTTPClient{}
+			resp, err := client.Get(context.Background(), &(url.URL{
+				Scheme: "http", Host: s.service.cfg.ListenAddr, Path: tc.bodyFile, RawQuery: tc.query.Encode(),
+			}))
+			require.NoError(s.T(), err, "Get")
+			require.Equal(s.T(), http.StatusOK, resp.StatusCode, "StatusCode")
+			respBody, err := io.ReadAll(resp.Body)
+			require.NoError(s.T(), err, "ReadAll resp.Body")
+			require.NoError(s.T(), resp.Body.Close(), "Close resp.Body")
+			s.Equal(tc.wantRemaining, resp.Header.Get(RemainingItemsHeader), RemainingItemsHeader)
+
+			unstrList := &unstructured.UnstructuredList{}
+			require.NoError(s.T(), unstrList.UnmarshalJSON(respBody), "UnmarshalJSON resp.Body")
+			names := []string{}
+			for _, item := range unstrList.Items {
+				names = append(names, item.GetName())
+			}
+			s.Equal(tc.want, names)
+			if tc.wantRemaining == "" {
+				s.Nil(unstrList.GetRemainingItemCount(), "remainingItemCount")
+			} else if s.NotNil(unstrList.GetRemainingItemCount(), "remainingItemCount") {
+				s.Equal(tc.wantRemaining, strconv.FormatInt(*unstrList.GetRemainingItemCount(), 10), "remainingItemCount")
+			}
+		})
+	}
+}
+
+func (s *ServiceTestSuite) TestService_Proxy_KubectlLimit_Invalid() {
+	for _, query := range []url.Values{{KubectlLimitParam: {"0"}}, {KubectlSortByParam: {"-"}}} {
+		client := HTTPClient{}
+		resp, err := client.Get(context.Background(), &(url.URL{
+			Scheme: "http", Host: s.service.cfg.ListenAddr, Path: "/podlist-status/redis.json", RawQuery: query.Encode(),
+		}))
+		require.NoError(s.T(), err, "Get")
+		resp.Body.Close()
+		s.Equal(http.StatusBadRequest, resp.StatusCode, query.Encode())
+	}
+}
+
+func (s *ServiceTestSuite) TestSortItems_Mixed() {
+	values := []interface{}{"b", int64(10), nil, "1/2", "5m", "a", int64(2), nil, ""}
+	items := make([]unstructured.Unstructured, len(values))
+	for i, value := range values {
+		items[i].SetName(strconv.Itoa(i))
+		if value != nil {
+			items[i].Object["kubectl"] = map[string]interface{}{"X": value}
+		}
+	}
+
+	sortItems(items, []kubectlSortKey{{column: "X"}}, "kubectl")
+	names := []string{}
+	for _, item := range items {
+		names = append(names, item.GetName())
+	}
+	s.Equal([]string{"2", "7", "3", "6", "1", "4", "8", "5", "0"}, names, "ascending")
+
+	sortItems(items, []kubectlSortKey{{column: "X", descending: true}}, "kubectl")
+	names = []string{}
+	for _, item := range items {
+		names = append(names, item.GetName())
+	}
+	s.Equal([]string{"0", "5", "8", "4", "1", "6", "3", "2", "7"}, names, "descending")
+}
+
+func (s *ServiceTestSuite) TestLimitItems_UpstreamRemaining() {
+	list := &unstructured.UnstructuredList{Object: map[string]interface{}{}}
+	list.Items = make([]unstructured.Unstructured, 5)
+	upstream := int64(10)
+	list.SetRemainingItemCount(&upstream)
+	header := http.Header{}
+
+	limitItems(list, 2, header)
+	s.Len(list.Items, 2, "Items")
+	s.Equal("3", header.Get(RemainingItemsHeader), RemainingItemsHeader)
+	require.NotNil(s.T(), list.GetRemainingItemCount(), "remainingItemCount")
+	s.Equal(int64(13), *list.GetRemainingItemCount(), "remainingItemCount")
+}
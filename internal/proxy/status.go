@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// newStatus creates a Kubernetes Status of a failure, same to the error responses of the API server
+func newStatus(code int, reason metav1.StatusReason, message string) *metav1.Status {
+	return &metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Message:  message,
+		Reason:   reason,
+		Code:     int32(code),
+	}
+}
+
+// newStatusResponse creates a response of the request with the Status body
+func newStatusResponse(r *http.Request, status *metav1.Status) *http.Response {
+	body, _ := json.Marshal(status) // nolint:errcheck // never fails
+
+	return &http.Response{
+		Status:     strconv.Itoa(int(status.Code)) + " " + http.StatusText(int(status.Code)),
+		StatusCode: int(status.Code),
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Content-Type":   []string{"application/json"},
+			"Content-Length": []string{strconv.Itoa(len(body))},
+		},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}
+}
+
+// statusReasonOf returns the reason of the status code, same to the API server
+func statusReasonOf(code int) metav1.StatusReason {
+	switch code {
+	case http.StatusBadRequest:
+		return metav1.StatusReasonBadRequest
+	case http.StatusUnauthorized:
+		return metav1.StatusReasonUnauthorized
+	case http.StatusForbidden:
+		return metav1.StatusReasonForbidden
+	case http.StatusNotFound:
+		return metav1.StatusReasonNotFound
+	case http.StatusMethodNotAllowed:
+		return metav1.StatusReasonMethodNotAllowed
+	case http.StatusNotAcceptable:
+		return metav1.StatusReasonNotAcceptable
+	case http.StatusGone:
+		return metav1.StatusReasonExpired
+	case http.StatusRequestEntityTooLarge:
+		return metav1.StatusReasonRequestEntityTooLarge
+	case http.StatusTooManyRequests:
+		return metav1.StatusReasonTooManyRequests
+	case http.StatusServiceUnavailable:
+		return metav1.StatusReasonServiceUnavailable
+	case http.StatusGatewayTimeout:
+		return metav1.StatusReasonTimeout
+	}
+	if code >= http.StatusInternalServerError {
+		return metav1.StatusReasonInternalError
+	}
+
+	return metav1.StatusReasonUnknown
+}
+
+// writeError sends a failure of the proxy as a Kubernetes Status (instead of the plain text of http.Error),
+// so kubectl and client-go can parse it
+func writeError(w http.ResponseWriter, code int, message string) {
+	body, _ := json.Marshal(newStatus(code, statusReasonOf(code), message)) // nolint:errcheck // never fails
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	w.Write(body) // nolint:errcheck,gosec // client error
+}
+
+// setStatusResponse replaces the status and the body of the response by a Status
+func setStatusResponse(resp *http.Response, code int, message string) {
+	body, _ := json.Marshal(newStatus(code, statusReasonOf(code), message)) // nolint:errcheck // never fails
+	resp.StatusCode = code
+	resp.Status = strconv.Itoa(code) + " " + http.StatusText(code)
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("ETag")
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Set("X-Content-Type-Options", "nosniff")
+	setBody(resp, body)
+}
+
+// listErrorCode returns the status code of a list, which can't be filtered, sorted or limited:
+// 400 for a kind without kubectl columns, otherwise 500 (the enrichment failed)
+func listErrorCode(err error) int {
+	if errors.Is(err, configs.ErrUnsupportedKubectlKind) {
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+// upstreamErrorCode returns the status code of a failed upstream request:
+// 504 on timeout, 410 on expired continue token, otherwise 502
+func upstreamErrorCode(err error) int {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return http.StatusGatewayTimeout
+	case errors.Is(err, configs.ErrResourceExpired):
+		return http.StatusGone
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// addWarning adds a Warning header, same to the warnings of the API server (printed by kubectl)
+func addWarning(header http.Header, message string) {
+	header.Add("Warning", "299 - "+strconv.Quote(message))
+}
+
+// proxyErrorHandler is the ErrorHandler of the ReverseProxy: the unreachable upstream, the timeout
+// and the failures of ModifyResponse (for example: a corrupt compressed body) are sent as Status
+func (s *Service) proxyErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(r.Context().Err(), context.Canceled) {
+		s.log.Info("Request canceled by the client", "url", r.URL.String())
+	} else {
+		s.log.Error(err, "Proxy", "url", r.URL.String())
+	}
+	message := fmt.Sprintf("%s: %s", configs.ErrUpstreamFailed, err)
+	if name := s.upstreamOf(r).name; name != "" {
+		message = fmt.Sprintf("%s: %s: %s", configs.ErrUpstreamFailed, name, err)
+	}
+	writeError(w, upstreamErrorCode(err), message)
+}
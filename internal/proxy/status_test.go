@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+func (s *ServiceTestSuite) TestService_ErrorStatus() {
+	tests := []struct {
+		name       string
+		reqPath    string
+		query      url.Values
+		err        error
+		wantCode   int
+		wantReason metav1.StatusReason
+	}{
+		{
+			name: "Unreachable", reqPath: "/api/v1/pods", err: errors.New("connection refused"),
+			wantCode: http.StatusBadGateway, wantReason: metav1.StatusReasonInternalError,
+		},
+		{
+			name: "Timeout", reqPath: "/api/v1/pods", err: context.DeadlineExceeded,
+			wantCode: http.StatusGatewayTimeout, wantReason: metav1.StatusReasonTimeout,
+		},
+		{
+			name: "Invalid option", reqPath: "/api/v1/pods", query: url.Values{"kubectlLimit": []string{"x"}},
+			wantCode: http.StatusBadRequest, wantReason: metav1.StatusReasonBadRequest,
+		},
+		{
+			name: "Unknown cluster", reqPath: "/clusters/none/api/v1/pods",
+			wantCode: http.StatusNotFound, wantReason: metav1.StatusReasonNotFound,
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			cfg := s.service.cfg
+			if tc.err != nil {
+				cfg.ProxyTransport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+					return nil, tc.err
+				})
+			}
+			s.setConfig(cfg)
+
+			client := HTTPClient{}
+			resp, err := client.Get(context.Background(), &(url.URL{
+				Scheme: "http", Host: s.service.cfg.ListenAddr, Path: tc.reqPath, RawQuery: tc.query.Encode(),
+			}))
+			require.NoError(s.T(), err, "Get")
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(s.T(), err, "ReadAll")
+			require.NoError(s.T(), resp.Body.Close(), "Close")
+
+			require.Equal(s.T(), tc.wantCode, resp.StatusCode, "StatusCode")
+			require.Equal(s.T(), "application/json", resp.Header.Get("Content-Type"), "Content-Type")
+			status := metav1.Status{}
+			require.NoError(s.T(), json.Unmarshal(body, &status), "Unmarshal")
+			require.Equal(s.T(), "Status", status.Kind, "kind")
+			require.Equal(s.T(), metav1.StatusFailure, status.Status, "status")
+			require.Equal(s.T(), int32(tc.wantCode), status.Code, "code")
+			require.Equal(s.T(), tc.wantReason, status.Reason, "reason")
+			require.NotEmpty(s.T(), status.Message, "message")
+			if tc.err != nil {
+				require.Contains(s.T(), status.Message, configs.ErrUpstreamFailed.Error(), "message")
+			}
+		})
+	}
+}
+
+func (s *ServiceTestSuite) TestService_EnrichmentWarnings() {
+	for _, warnings := range []bool{false, true} {
+		s.service.cfg.EnrichmentWarnings = warnings
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+			"http://127.0.0.1:8001/api/v1/pods", http.NoBody)
+		require.NoError(s.T(), err, "NewRequest")
+		req.Header.Set("Accept", "application/json")
+		resp := newListResponse(req, []byte("k8s\x00invalid"), "")
+		resp.Header.Set("Content-Type", ContentTypeProtobuf)
+
+		require.NoError(s.T(), s.service.ModifyResponse(resp), "ModifyResponse")
+		require.Equal(s.T(), EnrichmentFailed, resp.Header.Get(EnrichmentHeader), EnrichmentHeader)
+		if warnings {
+			require.Regexp(s.T(), `^299 - "enrichment failed: .+"$`, resp.Header.Get("Warning"), "Warning")
+		} else {
+			require.Empty(s.T(), resp.Header.Get("Warning"), "Warning")
+		}
+	}
+}
@@ -0,0 +1,552 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// streamable returns true, if the list items of the response can be rewritten one by one:
+// a JSON response of a GET request, without sorting, limit and custom columns output.
+// In EnrichmentStrict mode, the lists are buffered, because a streamed list can't be forwarded untouched on error.
+// The bodies without items (objects) are buffered by streamResponse.
+func (s *Service) streamable(resp *http.Response) bool {
+	s.mu.RLock()
+	enabled := s.cfg.StreamLists && !s.cfg.EnrichmentStrict
+	s.mu.RUnlock()
+	if !enabled || resp.StatusCode != http.StatusOK || resp.Request == nil || resp.Request.Method != http.MethodGet ||
+		!strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return false
+	}
+	opts := getRequestOptions(resp.Request)
+
+	return len(opts.sortBy) == 0 && opts.limit == 0 && opts.output == ""
+}
+
+// streamResponse replaces the body of the response by the streamed, rewritten body.
+// The top-level fields before the items are read before, so the ETag of the list can be set.
+// The ETag is sent before the items, so if an item fails, the ETag is only remembered as failed
+// (not answered by 304 later, see failedETags).
+// If the body has no items (an object), it's extended as a buffered body, see extendObject.
+// The size of an item or a top-level field is limited (0: unlimited), instead of the whole body.
+// The streamed body is compressed by the Accept-Encoding of the client, regardless of CompressionMinSize.
+func (s *Service) streamResponse(resp *http.Response, body io.ReadCloser, limit int64) error {
+	guard := &sizeGuard{reader: body, limit: limit}
+	dec := json.NewDecoder(guard)
+	guard.consumed = dec.InputOffset
+	head, err := readStreamHead(dec)
+	if err != nil {
+		body.Close() // nolint:errcheck,gosec // read error is returned
+
+		return err
+	}
+	if !head.hasItems {
+		return s.extendObject(resp, dec, head, body, limit)
+	}
+	if err := s.checkStreamKind(resp.Request, head); err != nil {
+		setStatusResponse(resp, listErrorCode(err), err.Error())
+
+		return body.Close() // nolint:wrapcheck // transparent
+	}
+	if s.conditionalResponse(resp, head.resourceVersion()) {
+		return body.Close() // nolint:wrapcheck // transparent
+	}
+
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	resp.Header.Del("Content-Encoding")
+
+	reader, writer := io.Pipe()
+	var out io.Writer = writer
+	var encoder io.WriteCloser
+	if compression := s.compressionOf(resp); compression.encoding != "" {
+		if encoder, err = encoders[compression.encoding](writer, compression.level); err != nil {
+			s.log.Error(err, "Compress", "encoding", compression.encoding)
+		} else {
+			out = encoder
+			setCompressionHeaders(resp.Header, compression.encoding)
+		}
+	}
+	req := resp.Request
+	etag := resp.Header.Get("ETag")
+	go func() {
+		failed, err := s.streamBody(req, dec, head, out)
+		if failed > 0 && etag != "" {
+			s.failedETags.add(etag)
+		}
+		if encoder != nil {
+			if errEncoder := encoder.Close(); err == nil && errEncoder != nil {
+				err = fmt.Errorf("compress: %w", errEncoder)
+			}
+		}
+		if errClose := body.Close(); err == nil && errClose != nil {
+			err = fmt.Errorf("resp body close: %w", errClose)
+		}
+		if err != nil {
+			s.log.Error(err, "StreamBody")
+		}
+		writer.CloseWithError(err) // nolint:errcheck // always nil
+	}()
+
+	resp.Body = reader
+
+	return nil
+}
+
+// extendObject extends a body without items (read by readStreamHead) same to the buffered bodies,
+// see extendResponse. The body is forwarded untouched, if it's larger than the limit (0: unlimited).
+func (s *Service) extendObject(resp *http.Response, dec *json.Decoder, head *streamHead, body io.ReadCloser,
+	limit int64,
+) error {
+	_, err := dec.Token()
+	if errClose := body.Close(); err == nil && errClose != nil {
+		return fmt.Errorf("resp body close: %w", errClose)
+	} else if err != nil {
+		return fmt.Errorf("stream end: %w", err)
+	}
+
+	object := marshalStreamFields(head.fields)
+	resp.Header.Del("Content-Encoding")
+	if limit > 0 && int64(len(object)) > limit {
+		setBody(resp, object)
+		s.skipEnrichment(resp, SkipBodyTooLarge, "max", limit)
+
+		return nil
+	}
+
+	return s.extendResponse(resp, object)
+}
+
+// checkStreamKind returns ErrUnsupportedKubectlKind, if the list is filtered, but its kind has no kubectl columns
+// (same to finishList). The items of a generic List (the kind is unknown before the items) are filtered as they are.
+func (s *Service) checkStreamKind(req *http.Request, head *streamHead) error {
+	opts := getRequestOptions(req)
+	kind := strings.TrimSuffix(head.listKind, "List")
+	if len(opts.selector) == 0 || opts.anyKind() || kind == "" {
+		return nil
+	}
+	if _, has := s.modifierOf(req, schema.FromAPIVersionAndKind(head.listAPIVersion, kind), configs.ScopeList); !has {
+		return fmt.Errorf("%w: %s", configs.ErrUnsupportedKubectlKind, kind)
+	}
+
+	return nil
+}
+
+// streamField is a top-level field of the body
+type streamField struct {
+	key   string
+	value json.RawMessage
+}
+
+// streamHead is the beginning of a streamed body: the top-level fields before the items
+type streamHead struct {
+	fields         []streamField
+	listKind       string
+	listAPIVersion string
+	// hasItems is true, if the items key is read (the next token is the items array)
+	hasItems bool
+}
+
+// readStreamHead reads the top-level fields until the items key or the end of the body
+func readStreamHead(dec *json.Decoder) (*streamHead, error) {
+	if tok, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("stream token: %w", err)
+	} else if tok != json.Delim('{') {
+		return nil, fmt.Errorf("stream token: %w: %v", errBodyNotExtended, tok)
+	}
+
+	head := &streamHead{fields: []streamField{}}
+	for dec.More() {
+		field, err := readStreamField(dec, true)
+		if err != nil {
+			return nil, err
+		}
+		if field.key == "items" && field.value == nil {
+			head.hasItems = true
+
+			return head, nil
+		}
+		switch field.key {
+		case "kind":
+			_ = json.Unmarshal(field.value, &head.listKind) // nolint:errcheck // checked by the value
+			if !strings.HasSuffix(head.listKind, "List") {
+				head.listKind = ""
+			}
+		case "apiVersion":
+			_ = json.Unmarshal(field.value, &head.listAPIVersion) // nolint:errcheck // checked by the value
+		}
+		head.fields = append(head.fields, *field)
+	}
+
+	return head, nil
+}
+
+// resourceVersion returns the metadata.resourceVersion of the head, "" if it's unknown (yet)
+func (h *streamHead) resourceVersion() string {
+	for _, field := range h.fields {
+		if field.key == "metadata" {
+			return bodyResourceVersion([]byte(`{"metadata":` + string(field.value) + `}`))
+		}
+	}
+
+	return ""
+}
+
+// readStreamField reads a top-level field. The value of the items key isn't read, if stopAtItems is set.
+func readStreamField(dec *json.Decoder, stopAtItems bool) (*streamField, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("stream key: %w", err)
+	}
+	key, is := tok.(string)
+	if !is {
+		return nil, fmt.Errorf("stream key: %w: %v", errBodyNotExtended, tok)
+	}
+	field := &streamField{key: key}
+	if key == "items" && stopAtItems {
+		return field, nil
+	}
+	if err := dec.Decode(&field.value); err != nil {
+		return nil, fmt.Errorf("stream %s: %w", key, err)
+	}
+
+	return field, nil
+}
+
+// streamBody rewrites a list body after the head, the items are decoded, enriched, filtered and encoded
+// one at a time. The top-level fields are kept in the original order. Returns the number of the failed items.
+func (s *Service) streamBody(req *http.Request, dec *json.Decoder, head *streamHead, w io.Writer) (int, error) {
+	out := bufio.NewWriter(w)
+	if err := writeStreamFields(out, head.fields, true); err != nil {
+		return 0, err
+	}
+	failed, err := s.streamItems(req, dec, out, head.listKind, head.listAPIVersion)
+	if err != nil {
+		return failed, err
+	}
+	for dec.More() {
+		field, err := readStreamField(dec, false)
+		if err != nil {
+			return failed, err
+		}
+		if err := writeStreamFields(out, []streamField{*field}, false); err != nil {
+			return failed, err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return failed, fmt.Errorf("stream end: %w", err)
+	}
+	if err := out.WriteByte('}'); err != nil {
+		return failed, fmt.Errorf("stream write: %w", err)
+	}
+
+	return failed, out.Flush() // nolint:wrapcheck // OK
+}
+
+// writeStreamFields writes the top-level fields, begins the object or continues it
+func writeStreamFields(out *bufio.Writer, fields []streamField, begin bool) error {
+	buf := bytes.Buffer{}
+	if begin {
+		buf.WriteByte('{')
+	}
+	for i, field := range fields {
+		if i > 0 || !begin {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.key) // nolint:errcheck // string
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(field.value)
+	}
+	if begin {
+		if len(fields) > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(`"items":`)
+	}
+	if _, err := out.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("stream write: %w", err)
+	}
+
+	return nil
+}
+
+// marshalStreamFields returns the object of the top-level fields
+func marshalStreamFields(fields []streamField) []byte {
+	buf := bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.key) // nolint:errcheck // string
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(field.value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes()
+}
+
+// streamJoins are the additional resources of the streamed Pods, fetched at the first Pod
+// (once, the items are enriched concurrently)
+type streamJoins struct {
+	once      sync.Once
+	usages    map[string]v1.ResourceList
+	usagesErr error
+	warnings  map[string][]*podEvent
+}
+
+// streamItems rewrites the items array. Items of kinds without modifier are copied.
+// On enrichment error, the item is annotated (see annotateItemError), the number of the failed items is returned.
+// The items are enriched by the worker pool (see enrichWorkers), in order, see pipeItems.
+func (s *Service) streamItems(req *http.Request, dec *json.Decoder, out *bufio.Writer,
+	listKind string, listAPIVersion string,
+) (int, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return 0, fmt.Errorf("stream items: %w", err)
+	}
+	if tok == nil {
+		_, err := out.WriteString("null")
+
+		return 0, err // nolint:wrapcheck // OK
+	}
+	if tok != json.Delim('[') {
+		return 0, fmt.Errorf("stream items: %w: %v", errBodyNotExtended, tok)
+	}
+	if err := out.WriteByte('['); err != nil {
+		return 0, fmt.Errorf("stream write: %w", err)
+	}
+
+	kind := strings.TrimSuffix(listKind, "List")
+	opts := getRequestOptions(req)
+	cluster := s.upstreamOf(req).name
+	joins := &streamJoins{}
+	enrich := func(raw json.RawMessage) streamItemResult {
+		body, keep, failed := s.streamItem(req, raw, kind, listAPIVersion, opts, cluster, joins)
+
+		return streamItemResult{body: body, keep: keep, failed: failed}
+	}
+	first := true
+	failed := 0
+	write := func(result streamItemResult) error {
+		if result.failed {
+			failed++
+		}
+		if !result.keep {
+			return nil
+		}
+		if !first {
+			if err := out.WriteByte(','); err != nil {
+				return fmt.Errorf("stream write: %w", err)
+			}
+		}
+		first = false
+		if _, err := out.Write(result.body); err != nil {
+			return fmt.Errorf("stream write: %w", err)
+		}
+
+		return nil
+	}
+	if err := pipeItems(dec, s.enrichWorkers(math.MaxInt32), enrich, write); err != nil {
+		return failed, err
+	}
+	if _, err := dec.Token(); err != nil {
+		return failed, fmt.Errorf("stream items end: %w", err)
+	}
+	if err := out.WriteByte(']'); err != nil {
+		return failed, fmt.Errorf("stream write: %w", err)
+	}
+
+	return failed, nil
+}
+
+// streamItemResult is an enriched item of a streamed list, see streamItem
+type streamItemResult struct {
+	body   []byte
+	keep   bool
+	failed bool
+}
+
+// pipeItems decodes the items of an array, enriches them by the workers and writes them in the original order.
+// Max 2 * workers items are decoded ahead of the written one, so the memory usage doesn't depend on the size
+// of the list. The write is called from one goroutine. After a write error, the rest of the items are dropped.
+func pipeItems(dec *json.Decoder, workers int, enrich func(raw json.RawMessage) streamItemResult,
+	write func(result streamItemResult) error,
+) error {
+	if workers <= 1 {
+		for dec.More() {
+			raw := json.RawMessage{}
+			if err := dec.Decode(&raw); err != nil {
+				return fmt.Errorf("stream item: %w", err)
+			}
+			if err := write(enrich(raw)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	type job struct {
+		raw    json.RawMessage
+		result chan streamItemResult
+	}
+	jobs := make(chan job)
+	pending := make(chan chan streamItemResult, 2*workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			for j := range jobs {
+				j.result <- enrich(j.raw)
+			}
+		}()
+	}
+	var writeFailed int32
+	written := make(chan error, 1)
+	go func() {
+		var err error
+		for result := range pending {
+			item := <-result
+			if err == nil {
+				if err = write(item); err != nil {
+					atomic.StoreInt32(&writeFailed, 1)
+				}
+			}
+		}
+		written <- err
+	}()
+
+	var err error
+	for dec.More() && atomic.LoadInt32(&writeFailed) == 0 {
+		raw := json.RawMessage{}
+		if err = dec.Decode(&raw); err != nil {
+			err = fmt.Errorf("stream item: %w", err)
+
+			break
+		}
+		result := make(chan streamItemResult, 1)
+		pending <- result
+		jobs <- job{raw: raw, result: result}
+	}
+	close(jobs)
+	close(pending)
+	if errWrite := <-written; errWrite != nil {
+		return errWrite
+	}
+
+	return err
+}
+
+// streamItem enriches and filters an item, returns false, if the item is filtered out,
+// and true, if the enrichment of the item failed.
+// The kind (and the apiVersion) of the item is taken from the list kind (can be unknown yet) or from the item.
+func (s *Service) streamItem(req *http.Request, raw json.RawMessage, kind string, apiVersion string,
+	opts *requestOptions, cluster string, joins *streamJoins,
+) ([]byte, bool, bool) {
+	if kind == "" {
+		typeMeta := struct {
+			Kind       string `json:"kind"`
+			APIVersion string `json:"apiVersion"`
+		}{}
+		_ = json.Unmarshal(raw, &typeMeta) // nolint:errcheck // checked by the value
+		kind = typeMeta.Kind
+		if typeMeta.APIVersion != "" {
+			apiVersion = typeMeta.APIVersion
+		}
+	}
+
+	modifier, has := s.modifierOf(req, schema.FromAPIVersionAndKind(apiVersion, kind), configs.ScopeList)
+	if !has && !opts.anyKind() {
+		return raw, true, false
+	}
+	content := map[string]interface{}{}
+	if err := utiljson.Unmarshal(raw, &content); err != nil {
+		s.log.Error(err, "StreamItem")
+
+		return raw, true, true
+	}
+	item := &unstructured.Unstructured{Object: content}
+	if item.GetKind() == "" {
+		item.SetKind(kind)
+	}
+	if item.GetAPIVersion() == "" && apiVersion != "" {
+		item.SetAPIVersion(apiVersion)
+	}
+
+	failed := false
+	if err := s.modifyItem(modifier, item, opts, cluster); err != nil {
+		failed = true
+		s.log.Error(err, "StreamItem", "item", itemRef(item))
+		enrichmentItemErrors.Inc()
+		s.annotateItemError(item, err, cluster)
+	} else if has {
+		s.joinStreamItem(req, item, joins)
+	}
+	if len(opts.selector) > 0 && !opts.selector.Matches(item, s.kindColumnsOf(item.GroupVersionKind().GroupKind()).key) {
+		return nil, false, failed
+	}
+
+	itemBody, err := item.MarshalJSON()
+	if err != nil {
+		s.log.Error(err, "StreamItem")
+
+		return raw, true, true
+	}
+
+	return itemBody, true, failed
+}
+
+// joinStreamItem joins the additional resources to a streamed Pod (same to the joins of a list).
+// The resources are fetched once, in the namespace of the request path.
+func (s *Service) joinStreamItem(req *http.Request, item *unstructured.Unstructured, joins *streamJoins) {
+	cfg := s.config()
+	if item.GetKind() != "Pod" || (!cfg.PodMetrics && !cfg.PodEvents) {
+		return
+	}
+	joins.once.Do(func() {
+		namespace := pathNamespace(req.URL.Path)
+		if cfg.PodMetrics {
+			if joins.usages, joins.usagesErr = s.getPodUsages(req.Context(), req, namespace); joins.usagesErr != nil {
+				s.log.Error(joins.usagesErr, "PodMetrics")
+			}
+		}
+		if cfg.PodEvents {
+			joins.warnings = s.getPodWarnings(req.Context(), req, namespace)
+		}
+	})
+
+	if cfg.PodMetrics {
+		s.setPodMetrics(item, joins.usages, joins.usagesErr)
+	}
+	if cfg.PodEvents {
+		s.setPodEvents(item, joins.warnings)
+	}
+}
+
+// pathNamespace returns the namespace of a request path, for example: /api/v1/namespaces/{namespace}/pods
+func pathNamespace(reqPath string) string {
+	parts := strings.Split(strings.Trim(reqPath, "/"), "/")
+	for i := 0; i+2 < len(parts); i++ {
+		if parts[i] == "namespaces" {
+			return parts[i+1]
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,254 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+	"github.com/pgillich/kubeproxy-ext/internal/logger"
+)
+
+func (s *ServiceTestSuite) TestService_Proxy_StreamLists() {
+	tests := []struct {
+		name    string
+		reqPath string
+		query   url.Values
+		joins   bool
+		object  bool
+	}{
+		{name: "Pods", reqPath: "/podlist-status/redis.json"},
+		{name: "Pods joins", reqPath: "/api/v1/namespaces/redis/pods", joins: true},
+		{name: "Pods filter", reqPath: "/podlist-status/mongo.json", query: url.Values{
+			"kubectlSelector": []string{"Status!=Running"},
+		}},
+		{name: "No pod", reqPath: "/podlist-status/no-pod.json"},
+		{name: "Pod", reqPath: "/pod-status/Running2.json", object: true},
+		{name: "Services", reqPath: "/svclist-status/monitoring.json"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			cfg := s.service.cfg
+			cfg.PodMetrics = tc.joins
+			cfg.PodEvents = tc.joins
+			cfg.StreamLists = false
+			s.setConfig(cfg)
+			wantBody, _ := s.getBody(tc.reqPath, tc.query)
+
+			cfg.StreamLists = true
+			s.setConfig(cfg)
+			gotBody, resp := s.getBody(tc.reqPath, tc.query)
+
+			require.JSONEq(s.T(), string(wantBody), string(gotBody), "Body")
+			if tc.object {
+				require.Equal(s.T(), int64(len(gotBody)), resp.ContentLength, "ContentLength of buffered object")
+			} else {
+				require.Equal(s.T(), int64(-1), resp.ContentLength, "ContentLength")
+			}
+		})
+	}
+}
+
+func (s *ServiceTestSuite) TestService_ModifyResponse_StreamLists_ObjectFailed() {
+	list := struct {
+		Items []json.RawMessage `json:"items"`
+	}{}
+	require.NoError(s.T(), json.Unmarshal([]byte(brokenPodList(s)), &list), "Unmarshal")
+	pod := map[string]interface{}{}
+	require.NoError(s.T(), json.Unmarshal(list.Items[0], &pod), "Unmarshal")
+	pod["kind"] = "Pod"
+	pod["apiVersion"] = "v1"
+	body, err := json.Marshal(pod)
+	require.NoError(s.T(), err, "Marshal")
+
+	for _, strict := range []bool{false, true} {
+		cfg := s.service.cfg
+		cfg.StreamLists = true
+		cfg.EnrichmentStrict = strict
+		cfg.ETag = true
+		cfg.EnrichmentWarnings = true
+		s.setConfig(cfg)
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://127.0.0.1:8001/",
+			http.NoBody)
+		require.NoError(s.T(), err, "NewRequest")
+		resp := newListResponse(req, body, "")
+		require.NoError(s.T(), s.service.ModifyResponse(resp), "ModifyResponse")
+		gotBody, err := io.ReadAll(resp.Body)
+		require.NoError(s.T(), err, "ReadAll")
+
+		require.JSONEq(s.T(), string(body), string(gotBody), "untouched, strict: %v", strict)
+		require.Equal(s.T(), EnrichmentFailed, resp.Header.Get(EnrichmentHeader), "strict: %v", strict)
+		require.NotEmpty(s.T(), resp.Header.Get("Warning"), "Warning, strict: %v", strict)
+		require.Empty(s.T(), resp.Header.Get("ETag"), "ETag, strict: %v", strict)
+	}
+}
+
+func (s *ServiceTestSuite) TestService_ModifyResponse_StreamLists_Gzip() {
+	cfg := s.service.cfg
+	cfg.StreamLists = true
+	s.setConfig(cfg)
+	body, err := os.ReadFile("../../test/podlist-status/redis.json")
+	require.NoError(s.T(), err, "ReadFile")
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://127.0.0.1:8001/", http.NoBody)
+	require.NoError(s.T(), err, "NewRequest")
+	resp := newListResponse(req, body, "")
+	require.NoError(s.T(), s.service.ModifyResponse(resp), "ModifyResponse")
+	wantBody, err := io.ReadAll(resp.Body)
+	require.NoError(s.T(), err, "ReadAll")
+
+	resp = newListResponse(req, body, "gzip")
+	require.NoError(s.T(), s.service.ModifyResponse(resp), "ModifyResponse gzip")
+	require.Empty(s.T(), resp.Header.Get("Content-Encoding"), "Content-Encoding")
+	gotBody, err := io.ReadAll(resp.Body)
+	require.NoError(s.T(), err, "ReadAll gzip")
+	require.NoError(s.T(), resp.Body.Close(), "Close")
+
+	require.JSONEq(s.T(), string(wantBody), string(gotBody), "Body")
+	unstrList := &unstructured.UnstructuredList{}
+	require.NoError(s.T(), unstrList.UnmarshalJSON(gotBody), "UnmarshalJSON")
+	require.NotEmpty(s.T(), unstrList.Items, "Items")
+	_, has := unstrList.Items[0].Object[configs.ObjectKeyKubectl]
+	require.True(s.T(), has, configs.ObjectKeyKubectl)
+}
+
+func (s *ServiceTestSuite) TestService_ModifyResponse_StreamLists_Invalid() {
+	cfg := s.service.cfg
+	cfg.StreamLists = true
+	s.setConfig(cfg)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://127.0.0.1:8001/", http.NoBody)
+	require.NoError(s.T(), err, "NewRequest")
+
+	resp := newListResponse(req, []byte(`{"kind":"PodList","items":[{"metadata":`), "")
+	require.NoError(s.T(), s.service.ModifyResponse(resp), "ModifyResponse")
+	_, err = io.ReadAll(resp.Body)
+	require.Error(s.T(), err, "ReadAll")
+}
+
+func (s *ServiceTestSuite) TestPathNamespace() {
+	require.Equal(s.T(), "redis", pathNamespace("/api/v1/namespaces/redis/pods"), "pods")
+	require.Equal(s.T(), "redis", pathNamespace("/apis/apps/v1/namespaces/redis/deployments"), "deployments")
+	require.Equal(s.T(), "", pathNamespace("/api/v1/namespaces/redis"), "namespace")
+	require.Equal(s.T(), "", pathNamespace("/api/v1/pods"), "all")
+}
+
+// getBody GETs the path by the proxy and returns the body
+func (s *ServiceTestSuite) getBody(reqPath string, query url.Values) ([]byte, *http.Response) {
+	s.T().Helper()
+	client := HTTPClient{}
+	resp, err := client.Get(context.Background(),
+		&(url.URL{Scheme: "http", Host: s.service.cfg.ListenAddr, Path: reqPath, RawQuery: query.Encode()}))
+	require.NoError(s.T(), err, "Get")
+	require.Equal(s.T(), http.StatusOK, resp.StatusCode, "StatusCode")
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(s.T(), err, "ReadAll resp.Body")
+	require.NoError(s.T(), resp.Body.Close(), "Close resp.Body")
+
+	return body, resp
+}
+
+func newListResponse(req *http.Request, body []byte, contentEncoding string) *http.Response {
+	headers := http.Header{"Content-Type": []string{"application/json"}}
+	if contentEncoding == "gzip" {
+		buf := bytes.Buffer{}
+		writer := gzip.NewWriter(&buf)
+		writer.Write(body) // nolint:errcheck,gosec // bytes.Buffer
+		writer.Close()     // nolint:errcheck,gosec // bytes.Buffer
+		body = buf.Bytes()
+		headers.Set("Content-Encoding", contentEncoding)
+	}
+
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.0",
+		ProtoMajor:    1,
+		Header:        headers,
+		Close:         true,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// scaledPodList multiplies the items of a Pod list file
+func scaledPodList(b *testing.B, file string, size int) []byte {
+	b.Helper()
+	body, err := os.ReadFile(file)
+	require.NoError(b, err, "ReadFile")
+	unstrList := &unstructured.UnstructuredList{}
+	require.NoError(b, unstrList.UnmarshalJSON(body), "UnmarshalJSON")
+
+	items := make([]unstructured.Unstructured, 0, size)
+	for i := 0; len(items) < size; i++ {
+		item := unstrList.Items[i%len(unstrList.Items)].DeepCopy()
+		item.SetName(fmt.Sprintf("%s-%d", item.GetName(), i))
+		items = append(items, *item)
+	}
+	unstrList.Items = items
+	body, err = unstrList.MarshalJSON()
+	require.NoError(b, err, "MarshalJSON")
+
+	return body
+}
+
+func BenchmarkModifyResponse(b *testing.B) {
+	for _, size := range []int{100, 5000} {
+		body := scaledPodList(b, "../../test/podlist-status/redis.json", size)
+		for _, streamLists := range []bool{false, true} {
+			for _, workers := range []int{1, 0} {
+				benchmarkModifyResponse(b, body, size, streamLists, workers)
+			}
+		}
+	}
+}
+
+// benchmarkModifyResponse runs ModifyResponse on a list, sequentially (1 worker) or in parallel (0: GOMAXPROCS)
+func benchmarkModifyResponse(b *testing.B, body []byte, size int, streamLists bool, workers int) {
+	b.Helper()
+	mode := "Buffered"
+	if streamLists {
+		mode = "Streamed"
+	}
+	parallel := "Sequential"
+	if workers != 1 {
+		parallel = "Parallel"
+	}
+	b.Run(fmt.Sprintf("%s/%s/%d", mode, parallel, size), func(b *testing.B) {
+		service, err := New(configs.Proxy{
+			TargetURL:     "http://127.0.0.1:8001",
+			PodResources:  true,
+			StreamLists:   streamLists,
+			EnrichWorkers: workers,
+			HTTPServer:    &TestServer{},
+		}, logger.New().Logger)
+		require.NoError(b, err, "New")
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+			"http://127.0.0.1:8001/api/v1/pods", http.NoBody)
+		require.NoError(b, err, "NewRequest")
+
+		b.ReportAllocs()
+		b.SetBytes(int64(len(body)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			resp := newListResponse(req, body, "")
+			if err := service.ModifyResponse(resp); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+				b.Fatal(err)
+			}
+			resp.Body.Close() // nolint:errcheck,gosec // not important
+		}
+	})
+}
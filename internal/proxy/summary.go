@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// SummaryPath is the endpoint of the Pod summary, for example:
+// curl '127.0.0.1:8003/kubeproxy-ext/v1/summary?namespace=redis&groupBy=node,status'
+const SummaryPath = "/kubeproxy-ext/v1/summary"
+
+// Dimensions of the Pod summary
+const (
+	SummaryByNamespace = "namespace"
+	SummaryByNode      = "node"
+	SummaryByStatus    = "status"
+	SummaryByOwnerKind = "ownerKind"
+)
+
+var summaryDimensions = []string{ // nolint:gochecknoglobals // constant
+	SummaryByNamespace, SummaryByNode, SummaryByStatus, SummaryByOwnerKind,
+}
+
+// PodSummary is the response of SummaryPath.
+// Items are the counts grouped by the dimensions of the groupBy query parameter, usable as a Grafana table.
+type PodSummary struct {
+	Kind        string                   `json:"kind"`
+	APIVersion  string                   `json:"apiVersion"`
+	Total       int64                    `json:"total"`
+	ByNamespace map[string]int64         `json:"byNamespace"`
+	ByNode      map[string]int64         `json:"byNode"`
+	ByStatus    map[string]int64         `json:"byStatus"`
+	ByOwnerKind map[string]int64         `json:"byOwnerKind"`
+	Items       []map[string]interface{} `json:"items"`
+}
+
+// serveSummary lists the Pods (cluster-wide or in a namespace) and counts them by the kubectl STATUS column,
+// namespace, node and owner kind. The labelSelector and fieldSelector query parameters are forwarded.
+func (s *Service) serveSummary(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	groupBy := []string{SummaryByNamespace, SummaryByStatus}
+	if query.Get("groupBy") != "" {
+		groupBy = strings.Split(query.Get("groupBy"), ",")
+		for _, dimension := range groupBy {
+			if !containsString(summaryDimensions, dimension) {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid groupBy: %s, valid values: %s",
+					dimension, strings.Join(summaryDimensions, ",")))
+
+				return
+			}
+		}
+	}
+
+	podsPath := "/api/v1/pods"
+	if namespace := query.Get("namespace"); namespace != "" {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid namespace: %s", strings.Join(errs, ", ")))
+
+			return
+		}
+		podsPath = "/api/v1/namespaces/" + namespace + "/pods"
+	}
+	listQuery := url.Values{}
+	for _, key := range []string{"labelSelector", "fieldSelector"} {
+		if value := query.Get(key); value != "" {
+			listQuery.Set(key, value)
+		}
+	}
+
+	body, err := s.getUpstream(r.Context(), r, podsPath, listQuery)
+	if err != nil {
+		s.log.Error(err, "Summary")
+		writeError(w, upstreamErrorCode(err), err.Error())
+
+		return
+	}
+	podList := &unstructured.UnstructuredList{}
+	if err := podList.UnmarshalJSON(body); err != nil {
+		s.log.Error(err, "Summary")
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("unmarshaljson podlist: %s", err))
+
+		return
+	}
+
+	summary, failures := s.summarizePods(podList, groupBy)
+	if failures != nil {
+		s.log.Error(failures.first, "Summary", "failed", failures.failed)
+		addWarning(w.Header(), fmt.Sprintf("Unknown status of %d Pod(s), first: %s", failures.failed, failures.first))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(summary); err != nil {
+		s.log.Error(err, "Summary")
+	}
+}
+
+// summarizePods counts the Pods. The Pods, which can't be printed, are counted by Unknown status
+// and summarised in the returned enrichFailures (nil, if there is no failure).
+func (s *Service) summarizePods(podList *unstructured.UnstructuredList, groupBy []string,
+) (*PodSummary, *enrichFailures) {
+	summary := &PodSummary{
+		Kind:        "PodSummary",
+		APIVersion:  "kubeproxy-ext/v1",
+		ByNamespace: map[string]int64{},
+		ByNode:      map[string]int64{},
+		ByStatus:    map[string]int64{},
+		ByOwnerKind: map[string]int64{},
+		Items:       []map[string]interface{}{},
+	}
+	groups := map[string]map[string]interface{}{}
+	var failures *enrichFailures
+
+	for i := range podList.Items {
+		item := &podList.Items[i]
+		_, table, err := s.generateTable(item, s.kindColumnsOf(podGroupKind))
+		if err != nil {
+			failures = failures.merge(&enrichFailures{failed: 1, first: fmt.Errorf("%s: %w", itemRef(item), err)})
+		}
+		dimensions := map[string]string{
+			SummaryByNamespace: item.GetNamespace(),
+			SummaryByNode:      "<none>",
+			SummaryByStatus:    "<unknown>",
+			SummaryByOwnerKind: "<none>",
+		}
+		if err != nil {
+			dimensions[SummaryByStatus] = "Unknown"
+		} else {
+			for c, column := range table.ColumnDefinitions {
+				if column.Name == "Status" {
+					dimensions[SummaryByStatus] = fmt.Sprintf("%v", table.Rows[0].Cells[c])
+				}
+			}
+		}
+		if node, _, _ := unstructured.NestedString(item.UnstructuredContent(), "spec", "nodeName"); node != "" {
+			dimensions[SummaryByNode] = node
+		}
+		if owners := item.GetOwnerReferences(); len(owners) > 0 {
+			dimensions[SummaryByOwnerKind] = owners[0].Kind
+			for _, owner := range owners {
+				if owner.Controller != nil && *owner.Controller {
+					dimensions[SummaryByOwnerKind] = owner.Kind
+				}
+			}
+		}
+
+		summary.Total++
+		summary.ByNamespace[dimensions[SummaryByNamespace]]++
+		summary.ByNode[dimensions[SummaryByNode]]++
+		summary.ByStatus[dimensions[SummaryByStatus]]++
+		summary.ByOwnerKind[dimensions[SummaryByOwnerKind]]++
+
+		keys := make([]string, 0, len(groupBy))
+		for _, dimension := range groupBy {
+			keys = append(keys, dimensions[dimension])
+		}
+		key := strings.Join(keys, "/")
+		group, has := groups[key]
+		if !has {
+			group = map[string]interface{}{"Count": int64(0)}
+			for _, dimension := range groupBy {
+				group[FormatKubectlColumn(dimension)] = dimensions[dimension]
+			}
+			groups[key] = group
+		}
+		group["Count"] = group["Count"].(int64) + 1 // nolint:forcetypeassert // set above
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		summary.Items = append(summary.Items, groups[key])
+	}
+
+	return summary, failures
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
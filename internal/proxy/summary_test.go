@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/stretchr/testify/require"
+)
+
+func (s *ServiceTestSuite) TestService_Summary() {
+	tests := []struct {
+		name       string
+		query      url.Values
+		wantStatus int
+		want       *PodSummary
+	}{
+		{
+			name:       "Namespace",
+			query:      url.Values{"namespace": []string{"redis"}},
+			wantStatus: http.StatusOK,
+			want: &PodSummary{
+				Kind:        "PodSummary",
+				APIVersion:  "kubeproxy-ext/v1",
+				Total:       5,
+				ByNamespace: map[string]int64{"redis": 5},
+				ByNode:      map[string]int64{"o-k8s-vps2": 3, "o-k8s-vps3": 2},
+				ByStatus:    map[string]int64{"Running": 4, "CrashLoopBackOff": 1},
+				ByOwnerKind: map[string]int64{"ReplicaSet": 3, "StatefulSet": 2},
+				Items: []map[string]interface{}{
+					{"Namespace": "redis", "Status": "CrashLoopBackOff", "Count": float64(1)},
+					{"Namespace": "redis", "Status": "Running", "Count": float64(4)},
+				},
+			},
+		},
+		{
+			name:       "Cluster GroupBy",
+			query:      url.Values{"groupBy": []string{"node,ownerKind"}},
+			wantStatus: http.StatusOK,
+			want: &PodSummary{
+				Kind:        "PodSummary",
+				APIVersion:  "kubeproxy-ext/v1",
+				Total:       5,
+				ByNamespace: map[string]int64{"mongo": 5},
+				ByNode:      map[string]int64{"o-k8s-vps1": 1, "o-k8s-vps2": 1, "o-k8s-vps3": 3},
+				ByStatus:    map[string]int64{"Running": 4, "Error": 1},
+				ByOwnerKind: map[string]int64{"<none>": 1, "ReplicaSet": 2, "StatefulSet": 2},
+				Items: []map[string]interface{}{
+					{"Node": "o-k8s-vps1", "OwnerKind": "StatefulSet", "Count": float64(1)},
+					{"Node": "o-k8s-vps2", "OwnerKind": "ReplicaSet", "Count": float64(1)},
+					{"Node": "o-k8s-vps3", "OwnerKind": "<none>", "Count": float64(1)},
+					{"Node": "o-k8s-vps3", "OwnerKind": "ReplicaSet", "Count": float64(1)},
+					{"Node": "o-k8s-vps3", "OwnerKind": "StatefulSet", "Count": float64(1)},
+				},
+			},
+		},
+		{
+			name:       "Invalid GroupBy",
+			query:      url.Values{"groupBy": []string{"phase"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Invalid Namespace",
+			query:      url.Values{"namespace": []string{"redis/pods/x"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Missing Namespace",
+			query:      url.Values{"namespace": []string{"missing"}},
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		s.Run(tc.name, func() {
+			client := HTTPClient{}
+			resp, err := client.Get(context.Background(), &(url.URL{
+				Scheme: "http", Host: s.service.cfg.ListenAddr, Path: SummaryPath, RawQuery: tc.query.Encode(),
+			}))
+			require.NoError(s.T(), err, "Get")
+			defer resp.Body.Close()
+			require.Equal(s.T(), tc.wantStatus, resp.StatusCode)
+			if tc.want == nil {
+				return
+			}
+
+			summary := &PodSummary{}
+			require.NoError(s.T(), json.NewDecoder(resp.Body).Decode(summary), "Decode")
+			s.Equal(tc.want, summary)
+		})
+	}
+}
+
+func (s *ServiceTestSuite) TestService_Summary_UnknownStatus() {
+	body := brokenPodList(s)
+	cfg := s.service.cfg
+	cfg.ProxyTransport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return newTestResponse(r, http.StatusOK, body), nil
+	})
+	s.setConfig(cfg)
+
+	client := HTTPClient{}
+	resp, err := client.Get(context.Background(), &(url.URL{
+		Scheme: "http", Host: s.service.cfg.ListenAddr, Path: SummaryPath,
+		RawQuery: url.Values{"namespace": []string{"redis"}}.Encode(),
+	}))
+	require.NoError(s.T(), err, "Get")
+	defer resp.Body.Close()
+	require.Equal(s.T(), http.StatusOK, resp.StatusCode)
+	require.Regexp(s.T(), `^299 - "Unknown status of 1 Pod\(s\), first: redis/.+"$`, resp.Header.Get("Warning"), "Warning")
+
+	summary := &PodSummary{}
+	require.NoError(s.T(), json.NewDecoder(resp.Body).Decode(summary), "Decode")
+	require.Equal(s.T(), int64(5), summary.Total, "Total")
+	require.Equal(s.T(), int64(1), summary.ByStatus["Unknown"], "Unknown")
+}
@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MetricsPath is the Prometheus endpoint of the proxy, for example:
+// curl '127.0.0.1:8003/kubeproxy-ext/v1/metrics'
+const MetricsPath = "/kubeproxy-ext/v1/metrics"
+
+const metricsNamespace = "kubeproxy_ext"
+
+// Results of the config reloads
+const (
+	ReloadSuccess = "success"
+	ReloadFailure = "failure"
+)
+
+var (
+	metricsHandler = promhttp.Handler() // nolint:gochecknoglobals // default registry
+
+	configReloads = promauto.NewCounterVec(prometheus.CounterOpts{ // nolint:gochecknoglobals // registered once
+		Namespace: metricsNamespace,
+		Name:      "config_reloads_total",
+		Help:      "Number of config reloads by result (success, failure)",
+	}, []string{"result"})
+	configLastReloadSuccess = promauto.NewGauge(prometheus.GaugeOpts{ // nolint:gochecknoglobals // registered once
+		Namespace: metricsNamespace,
+		Name:      "config_last_reload_success_timestamp_seconds",
+		Help:      "Timestamp of the last successful config reload",
+	})
+)
+
+// ObserveConfigReload records the result of a config reload
+func ObserveConfigReload(err error) {
+	if err != nil {
+		configReloads.WithLabelValues(ReloadFailure).Inc()
+
+		return
+	}
+	configReloads.WithLabelValues(ReloadSuccess).Inc()
+	configLastReloadSuccess.SetToCurrentTime()
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// getUpstream GETs an additional resource from the upstream (cluster) of the original request.
+// The Authorization header of the original request (can be nil) is forwarded, see bearerTransport.
+// The size of the body is limited by MaxBodySize. An expired continue token (410 Gone) is ErrResourceExpired,
+// a missing resource (404 Not Found) is ErrResourceNotFound.
+func (s *Service) getUpstream(ctx context.Context, req *http.Request, reqPath string, query url.Values) ([]byte, error) {
+	up := s.upstreamOf(req)
+	reqURL := *up.targetURL
+	reqURL.Path = path.Join(reqURL.Path, reqPath)
+	reqURL.RawQuery = query.Encode()
+	upReq, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	upReq.Header.Set("Accept", "application/json")
+	if req != nil && req.Header.Get("Authorization") != "" {
+		upReq.Header.Set("Authorization", req.Header.Get("Authorization"))
+	}
+
+	resp, err := up.client.Do(upReq)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", reqPath, err)
+	}
+	defer resp.Body.Close() // nolint:errcheck // not important
+
+	body, err := readLimited(resp.Body, s.maxBodySize())
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", reqPath, err)
+	}
+	if resp.StatusCode == http.StatusGone {
+		return nil, fmt.Errorf("get %s: %w", reqPath, configs.ErrResourceExpired)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("get %s: %w", reqPath, configs.ErrResourceNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get %s: %w %d", reqPath, configs.ErrUpstreamStatus, resp.StatusCode)
+	}
+
+	return body, nil
+}
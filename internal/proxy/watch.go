@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+)
+
+// watchEvent is an event of a JSON watch stream
+type watchEvent struct {
+	Type   watch.EventType `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// watchResponse replaces the body of a JSON watch response by the rewritten events, see streamWatch.
+// Other watch responses (protobuf, errors) are forwarded untouched.
+// The events aren't compressed, filtered or buffered, so they are sent to the client immediately.
+func (s *Service) watchResponse(resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return nil
+	}
+	body, err := decodeBody(resp)
+	if err != nil {
+		return err
+	}
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	resp.Header.Del("Content-Encoding")
+
+	reader, writer := io.Pipe()
+	req := resp.Request
+	limit := s.maxBodySize()
+	go func() {
+		err := s.streamWatch(req, body, limit, writer)
+		if errClose := body.Close(); err == nil && errClose != nil {
+			err = fmt.Errorf("resp body close: %w", errClose)
+		}
+		if err != nil && req.Context().Err() == nil {
+			s.log.Error(err, "WatchEvent")
+		}
+		writer.CloseWithError(err) // nolint:errcheck // always nil
+	}()
+	resp.Body = reader
+
+	return nil
+}
+
+// streamWatch rewrites the watch events one by one. The objects of the ADDED, MODIFIED and DELETED events
+// are enriched, see watchObject, other events (BOOKMARK, ERROR) are copied.
+// The size of an event is limited (0: unlimited).
+func (s *Service) streamWatch(req *http.Request, body io.Reader, limit int64, w io.Writer) error {
+	guard := &sizeGuard{reader: body, limit: limit}
+	dec := json.NewDecoder(guard)
+	guard.consumed = dec.InputOffset
+	opts := getRequestOptions(req)
+	cluster := s.upstreamOf(req).name
+	for {
+		event := watchEvent{}
+		if err := dec.Decode(&event); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("watch event: %w", err)
+		}
+		switch event.Type {
+		case watch.Added, watch.Modified, watch.Deleted:
+			event.Object = s.watchObject(req, event.Object, opts, cluster)
+		}
+		line, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("watch event: %w", err)
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("watch write: %w", err)
+		}
+	}
+}
+
+// watchObject enriches the object of a watch event by the modifiers of ScopeWatch and the custom columns.
+// The Pod joins aren't fetched. On enrichment error, the object is annotated (see annotateItemError),
+// or the original object is returned in EnrichmentStrict mode.
+func (s *Service) watchObject(req *http.Request, raw json.RawMessage, opts *requestOptions, cluster string,
+) json.RawMessage {
+	typeMeta := struct {
+		Kind       string `json:"kind"`
+		APIVersion string `json:"apiVersion"`
+	}{}
+	_ = json.Unmarshal(raw, &typeMeta) // nolint:errcheck // checked by the value
+
+	gvk := schema.FromAPIVersionAndKind(typeMeta.APIVersion, typeMeta.Kind)
+	modifier, has := s.modifierOf(req, gvk, configs.ScopeWatch)
+	if !has && !opts.anyKind() {
+		return raw
+	}
+	item := &unstructured.Unstructured{}
+	if err := item.UnmarshalJSON(raw); err != nil {
+		s.log.Error(err, "WatchEvent")
+
+		return raw
+	}
+	if err := s.modifyItem(modifier, item, opts, cluster); err != nil {
+		s.log.Error(err, "WatchEvent", "item", itemRef(item))
+		enrichmentItemErrors.Inc()
+		if s.config().EnrichmentStrict {
+			return raw
+		}
+		s.annotateItemError(item, err, cluster)
+	}
+	body, err := item.MarshalJSON()
+	if err != nil {
+		s.log.Error(err, "WatchEvent")
+
+		return raw
+	}
+
+	return body
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// enrichWorkers returns the number of the workers modifying the items of a list,
+// EnrichWorkers or GOMAXPROCS, but max the number of the items
+func (s *Service) enrichWorkers(items int) int {
+	workers := s.config().EnrichWorkers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > items {
+		workers = items
+	}
+
+	return workers
+}
+
+// modifyItems runs modifyItem on the items by a bounded worker pool. The order of the items is kept.
+// In EnrichmentStrict mode, the error of the first failed item is returned (same to the sequential run),
+// the items after it may be left unmodified. Otherwise all items are modified, the failed ones are annotated
+// (see annotateItemError) and summarised in the returned enrichFailures (nil, if there is no failure).
+func (s *Service) modifyItems(modifier func(item *unstructured.Unstructured) error, items []*unstructured.Unstructured,
+	opts *requestOptions, cluster string,
+) (*enrichFailures, error) {
+	strict := s.config().EnrichmentStrict
+	errs := make([]error, len(items))
+	workers := s.enrichWorkers(len(items))
+	if workers <= 1 {
+		for i, item := range items {
+			if errs[i] = s.modifyItem(modifier, item, opts, cluster); errs[i] != nil && strict {
+				return nil, errs[i]
+			}
+		}
+
+		return s.itemFailures(items, errs, cluster), nil
+	}
+
+	// The items are taken in order, so all items before the first failed item are modified.
+	next := int64(-1)
+	firstFailed := int64(len(items))
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := atomic.AddInt64(&next, 1)
+				if i >= int64(len(items)) || i > atomic.LoadInt64(&firstFailed) {
+					return
+				}
+				if errs[i] = s.modifyItem(modifier, items[i], opts, cluster); errs[i] != nil && strict {
+					for failed := atomic.LoadInt64(&firstFailed); i < failed; failed = atomic.LoadInt64(&firstFailed) {
+						if atomic.CompareAndSwapInt64(&firstFailed, failed, i) {
+							break
+						}
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstFailed < int64(len(items)) {
+		return nil, errs[firstFailed]
+	}
+
+	return s.itemFailures(items, errs, cluster), nil
+}
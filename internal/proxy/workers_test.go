@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/pgillich/kubeproxy-ext/configs"
+	"github.com/pgillich/kubeproxy-ext/internal/logger"
+)
+
+func (s *ServiceTestSuite) TestService_EnrichWorkers() {
+	cfg := s.service.cfg
+	cfg.PodResources = true
+	for _, file := range []string{"redis.json", "mongo.json", "rabbitmq-system.json", "longhorn-system.json"} {
+		for _, streamLists := range []bool{false, true} {
+			file := file
+			cfg.StreamLists = streamLists
+			s.Run(fmt.Sprintf("%s/%t", file, streamLists), func() {
+				cfg.EnrichWorkers = 1
+				s.setConfig(cfg)
+				wantBody, _ := s.getBody("/podlist-status/"+file, nil)
+
+				cfg.EnrichWorkers = 4
+				s.setConfig(cfg)
+				gotBody, _ := s.getBody("/podlist-status/"+file, nil)
+
+				require.Equal(s.T(), string(wantBody), string(gotBody), "Body")
+			})
+		}
+	}
+}
+
+func (s *ServiceTestSuite) TestPipeItems() {
+	items := make([]string, 100)
+	for i := range items {
+		items[i] = strconv.Itoa(i)
+	}
+	body := "[" + strings.Join(items, ",") + "]"
+	enrich := func(raw json.RawMessage) streamItemResult {
+		n, _ := strconv.Atoi(string(raw)) // nolint:errcheck // numbers
+		time.Sleep(time.Duration(n%7) * time.Millisecond)
+
+		return streamItemResult{body: raw, keep: n%10 != 0, failed: n%10 == 0}
+	}
+
+	for _, workers := range []int{1, 3, 16} {
+		dec := json.NewDecoder(strings.NewReader(body))
+		_, err := dec.Token()
+		require.NoError(s.T(), err, "Token")
+		got := []string{}
+		failed := 0
+		require.NoError(s.T(), pipeItems(dec, workers, enrich, func(result streamItemResult) error {
+			if result.failed {
+				failed++
+			}
+			if result.keep {
+				got = append(got, string(result.body))
+			}
+
+			return nil
+		}), "workers %d", workers)
+		require.Len(s.T(), got, 90, "workers %d", workers)
+		require.True(s.T(), sort.SliceIsSorted(got, func(i, j int) bool {
+			a, _ := strconv.Atoi(got[i]) // nolint:errcheck // numbers
+			b, _ := strconv.Atoi(got[j]) // nolint:errcheck // numbers
+
+			return a < b
+		}), "order, workers %d", workers)
+		require.Equal(s.T(), 10, failed, "workers %d", workers)
+
+		dec = json.NewDecoder(strings.NewReader(body))
+		_, err = dec.Token()
+		require.NoError(s.T(), err, "Token")
+		writes := 0
+		err = pipeItems(dec, workers, enrich, func(result streamItemResult) error {
+			writes++
+			if writes == 5 {
+				return errItemFailed
+			}
+
+			return nil
+		})
+		require.ErrorIs(s.T(), err, errItemFailed, "write error, workers %d", workers)
+		require.Equal(s.T(), 5, writes, "no write after error, workers %d", workers)
+	}
+}
+
+var errItemFailed = errors.New("failed")
+
+// failingItems returns items and a modifier, which fails on item-37, item-38 and item-90
+func failingItems() ([]*unstructured.Unstructured, func(item *unstructured.Unstructured) error) {
+	items := make([]*unstructured.Unstructured, 100)
+	for i := range items {
+		items[i] = &unstructured.Unstructured{Object: map[string]interface{}{}}
+		items[i].SetName(fmt.Sprintf("item-%d", i))
+	}
+	modifier := func(item *unstructured.Unstructured) error {
+		switch item.GetName() {
+		case "item-37", "item-38", "item-90":
+			return fmt.Errorf("%w: %s", errItemFailed, item.GetName())
+		}
+		item.SetLabels(map[string]string{"modified": "true"})
+
+		return nil
+	}
+
+	return items, modifier
+}
+
+func (s *ServiceTestSuite) TestService_EnrichWorkers_FirstError() {
+	items, modifier := failingItems()
+	s.service.cfg.EnrichmentStrict = true
+
+	for _, workers := range []int{1, 3, 16} {
+		s.service.cfg.EnrichWorkers = workers
+		for run := 0; run < 10; run++ {
+			_, err := s.service.modifyItems(modifier, items, &requestOptions{}, "")
+			require.ErrorIs(s.T(), err, errItemFailed, "workers %d", workers)
+			require.Contains(s.T(), err.Error(), "item-37", "workers %d", workers)
+			for i := 0; i < 37; i++ {
+				require.Equal(s.T(), "true", items[i].GetLabels()["modified"], "workers %d, item %d", workers, i)
+			}
+		}
+	}
+}
+
+func (s *ServiceTestSuite) TestService_EnrichWorkers_Isolated() {
+	for _, workers := range []int{1, 3, 16} {
+		items, modifier := failingItems()
+		s.service.cfg.EnrichWorkers = workers
+		failures, err := s.service.modifyItems(modifier, items, &requestOptions{}, "remote")
+		require.NoError(s.T(), err, "workers %d", workers)
+		require.NotNil(s.T(), failures, "workers %d", workers)
+		require.Equal(s.T(), 3, failures.failed, "workers %d", workers)
+		require.ErrorIs(s.T(), failures.first, errItemFailed, "workers %d", workers)
+		require.Contains(s.T(), failures.first.Error(), "item-37: ", "workers %d", workers)
+		for i, item := range items {
+			kubectlMap, _, _ := unstructured.NestedMap(item.Object, configs.ObjectKeyKubectl)
+			switch i {
+			case 37, 38, 90:
+				require.Contains(s.T(), kubectlMap[ErrorColumn], item.GetName(), "workers %d, item %d", workers, i)
+				require.Equal(s.T(), "remote", kubectlMap[ClusterColumn], "workers %d, item %d", workers, i)
+			default:
+				require.Equal(s.T(), "true", item.GetLabels()["modified"], "workers %d, item %d", workers, i)
+				require.NotContains(s.T(), kubectlMap, ErrorColumn, "workers %d, item %d", workers, i)
+			}
+		}
+	}
+
+	items := []*unstructured.Unstructured{{Object: map[string]interface{}{}}}
+	failures, err := s.service.modifyItems(func(*unstructured.Unstructured) error { return nil }, items,
+		&requestOptions{}, "")
+	require.NoError(s.T(), err, "success")
+	require.Nil(s.T(), failures, "success")
+}
+
+func (s *ServiceTestSuite) TestService_EnrichWorkers_Size() {
+	s.service.cfg.EnrichWorkers = 8
+	require.Equal(s.T(), 8, s.service.enrichWorkers(100), "configured")
+	require.Equal(s.T(), 3, s.service.enrichWorkers(3), "items")
+	s.service.cfg.EnrichWorkers = 0
+	require.Positive(s.T(), s.service.enrichWorkers(1000), "GOMAXPROCS")
+}
+
+func BenchmarkEnrichList(b *testing.B) {
+	for _, file := range []string{"redis.json", "mongo.json", "longhorn-system.json"} {
+		body := scaledPodList(b, "../../test/podlist-status/"+file, 1000)
+		for _, workers := range []int{1, 0} {
+			name := fmt.Sprintf("%s/Sequential", file)
+			if workers != 1 {
+				name = fmt.Sprintf("%s/Parallel", file)
+			}
+			b.Run(name, func(b *testing.B) {
+				service, err := New(configs.Proxy{
+					TargetURL:     "http://127.0.0.1:8001",
+					PodResources:  true,
+					EnrichWorkers: workers,
+					HTTPServer:    &TestServer{},
+				}, logger.New().Logger)
+				require.NoError(b, err, "New")
+				req, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+					"http://127.0.0.1:8001/api/v1/pods", http.NoBody)
+				require.NoError(b, err, "NewRequest")
+
+				b.ReportAllocs()
+				b.SetBytes(int64(len(body)))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, _, err := service.extendBody(req, body, http.Header{}); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}